@@ -0,0 +1,64 @@
+package peex_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andreashgk/peex"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/player/skin"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// SlowAdder signals that it was added and then takes a while, so that other goroutines can find the session before all
+// its components have been inserted.
+type SlowAdder struct {
+	added chan struct{}
+}
+
+func (a *SlowAdder) Add(*player.Player) {
+	close(a.added)
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestAcceptedSessionIsCompleteWhenIndexed(t *testing.T) {
+	m := peex.New(peex.Config{})
+	a := &SlowAdder{added: make(chan struct{})}
+	go func() {
+		if _, err := m.Accept(player.New("test", skin.Skin{}, mgl64.Vec3{}), a, &Marker{}); err != nil {
+			t.Error(err)
+		}
+	}()
+	<-a.added
+
+	sessions := peex.SessionsWith[*SlowAdder](m)
+	if len(sessions) != 1 {
+		t.Fatalf("%v sessions with the component, expected 1", len(sessions))
+	}
+	withTimeout(t, func() {
+		if !sessions[0].Query(func(peex.Query[*SlowAdder], peex.Query[*Marker]) {}) {
+			t.Error("session found through the index was queried before all its components were inserted")
+		}
+	})
+	if _, ok := m.SessionFromUUID(sessions[0].Player().UUID()); !ok {
+		t.Fatal("session found through the index is not stored in the manager")
+	}
+}
+
+func TestFailedAcceptIsRemoved(t *testing.T) {
+	m := peex.New(peex.Config{})
+	p := player.New("test", skin.Skin{}, mgl64.Vec3{})
+	if _, err := m.Accept(p, &Counter{}, &Counter{}); err == nil {
+		t.Fatal("accepted a session with the same component twice")
+	}
+	if _, ok := m.SessionFromPlayer(p); ok {
+		t.Fatal("session is still stored after it failed to be accepted")
+	}
+	if sessions := peex.SessionsWith[*Counter](m); len(sessions) != 0 {
+		t.Fatalf("%v sessions with a counter after failing to accept, expected none", len(sessions))
+	}
+	// The player can still be accepted afterwards.
+	if _, err := m.Accept(p, &Counter{}); err != nil {
+		t.Fatal(err)
+	}
+}
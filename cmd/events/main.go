@@ -118,6 +118,7 @@ func main() {
 	handlers := ""
 	interfaces := ""
 	getHandlerEvents := ""
+	generatedFields := ""
 	for _, event := range handlerInterface.Methods.List {
 		name := event.Names[0].Name
 		eventName := "event" + strings.TrimPrefix(name, "Handle")
@@ -140,14 +141,31 @@ func main() {
 		getHandlerEvents += fmt.Sprintf(getHandlerEventsTemplate, interfaceName, eventName)
 
 		eventArgs := ""
+		// The context is used to cancel the event if a handler reports a cancelling error, and the target is the entity
+		// involved in the event, if there is one. It is used to fill Target queries.
+		ctx, target := "nil", "nil"
 		for _, p := range method.Params.List {
 			for _, n := range p.Names {
 				eventArgs += ", " + n.Name
 			}
+			switch sourceContent[p.Type.Pos()-1 : p.Type.End()-1] {
+			case "*event.Context":
+				ctx = p.Names[0].Name
+			case "world.Entity":
+				target = p.Names[0].Name
+			}
 		}
 		eventArgs = strings.TrimPrefix(eventArgs, ", ")
 
-		methodBody := fmt.Sprintf(methodBodyTemplate, eventName, interfaceName, name, eventArgs)
+		// Generated handlers receive the same parameters as the handler method, prefixed by the dispatch.
+		generatedParams, generatedArgs := "d *Dispatch", "d"
+		if params := sourceContent[method.Params.Opening : method.Params.Closing-1]; params != "" {
+			generatedParams += ", " + params
+			generatedArgs += ", " + eventArgs
+		}
+		generatedFields += fmt.Sprintf("\n\t%s func(%s)", name, generatedParams)
+
+		methodBody := fmt.Sprintf(methodBodyTemplate, eventName, ctx, target, interfaceName, name, eventArgs, name, generatedArgs)
 		if eventName == "eventQuit" {
 			methodBody += "\n\ts.doQuit()" // to run the session specific logic when the player quits
 		}
@@ -162,6 +180,7 @@ func main() {
 		eventIds,
 		getHandlerEvents,
 		strings.TrimPrefix(allEvents, "\n\t"),
+		strings.TrimPrefix(generatedFields, "\n\t"),
 		strings.TrimPrefix(interfaces, "\n\n"),
 		strings.TrimPrefix(handlers, "\n\n"),
 	)
@@ -198,6 +217,12 @@ var allEvents = map[string]eventId{
 	%s
 }
 
+// GeneratedHandler contains functions that handle events for a single handler type without using reflection. It is
+// created by code generated using cmd/peexgen and passed to RegisterGenerated. It should not be created manually.
+type GeneratedHandler struct {
+	%s
+}
+
 %s
 
 %s
@@ -207,8 +232,10 @@ const methodTemplate = `func (s *Session) %s {
 	%s
 }`
 
-const methodBodyTemplate = `s.handleEvent(%s, func(h Handler) {
+const methodBodyTemplate = `s.handleEvent(%s, %s, %s, func(h Handler) {
 		h.(%s).%s(%s)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.%s(%s)
 	})`
 
 // interfaceTemplate is a template used for creating interfaces for event handlers.
@@ -0,0 +1,136 @@
+// Package testhandlers contains handlers with code generated by peexgen. It is used to test that the generated code is
+// up to date, compiles, and behaves the same as the reflection Peex uses for handlers without generated code.
+package testhandlers
+
+//go:generate go run github.com/andreashgk/peex/cmd/peexgen -type=Generated,Swapper
+
+import (
+	"errors"
+	"log/slog"
+	"runtime"
+	"strings"
+
+	"github.com/andreashgk/peex"
+	"github.com/df-mc/dragonfly/server/event"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+type Counter struct{ N int }
+
+type Marker struct{}
+
+type Team struct{ Name string }
+
+type Bonus struct{ N int }
+
+type Damageable interface {
+	Damage(amount float64)
+}
+
+type Knight struct{ Health float64 }
+
+func (k *Knight) Damage(amount float64) { k.Health -= amount }
+
+type Archer struct{ Health float64 }
+
+func (a *Archer) Damage(amount float64) { a.Health -= amount }
+
+// Record is what a handler saw while handling an event.
+type Record struct {
+	Generated bool
+	Player    string
+	Session   bool
+	Manager   bool
+	Logger    bool
+	Counter   int
+	Marker    bool
+	Team      string
+	Victim    string
+	Bonus     int
+	Prefix    string
+}
+
+// Generated is a handler that uses every kind of field, and records the values of its fields when its player attacks
+// another player.
+type Generated struct {
+	Player  *player.Player
+	Session *peex.Session
+	Manager *peex.Manager
+	Log     *slog.Logger
+	Errors  peex.Errors
+	Counter peex.Mut[*Counter]
+	Marker  peex.Option[*Marker]
+	Team    peex.Query[*Team]
+	Victim  peex.Target[peex.Query[*Team]]
+	Bonus   peex.Res[*Bonus]
+	Prefix  string
+	Records *[]Record
+	ignored int
+}
+
+func (h Generated) HandleAttackEntity(ctx *event.Context, e world.Entity, force, height *float64, critical *bool) {
+	if h.Team.Load().Name == h.Victim.Load().Load().Name {
+		ctx.Cancel()
+	}
+	h.record()
+}
+
+// record increments the counter, reports an error and appends a record of the fields of the handler.
+func (h Generated) record() {
+	h.Counter.Load().N++
+	h.Errors.Report(errors.New(h.Prefix + "error"))
+	_, marker := h.Marker.Load()
+	*h.Records = append(*h.Records, Record{
+		Generated: calledByGeneratedCode(),
+		Player:    h.Player.Name(),
+		Session:   h.Session != nil,
+		Manager:   h.Manager != nil,
+		Logger:    h.Log != nil,
+		Counter:   h.Counter.Load().N,
+		Marker:    marker,
+		Team:      h.Team.Load().Name,
+		Victim:    h.Victim.Load().Load().Name,
+		Bonus:     h.Bonus.Load().N,
+		Prefix:    h.Prefix,
+	})
+}
+
+// Reflected has the same fields and events as Generated, but has no generated code, so it always uses reflection.
+type Reflected Generated
+
+func (h Reflected) HandleAttackEntity(ctx *event.Context, e world.Entity, force, height *float64, critical *bool) {
+	Generated(h).HandleAttackEntity(ctx, e, force, height, critical)
+}
+
+// Swapper replaces the Damageable component of the session with an Archer, which panics if it is not one already.
+type Swapper struct {
+	Damageable peex.Mut[Damageable]
+}
+
+func (h Swapper) HandleJump() {
+	h.Damageable.Set(&Archer{})
+}
+
+// ReflectedSwapper works the same as Swapper, but always uses reflection.
+type ReflectedSwapper Swapper
+
+func (h ReflectedSwapper) HandleJump() {
+	Swapper(h).HandleJump()
+}
+
+// calledByGeneratedCode returns whether the handler was called by the generated code, which is registered in the init
+// function of this package.
+func calledByGeneratedCode() bool {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if strings.Contains(frame.Function, "testhandlers.init.") {
+			return true
+		}
+		if !more {
+			return false
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package testhandlers_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/andreashgk/peex"
+	"github.com/andreashgk/peex/cmd/peexgen/internal/testhandlers"
+	"github.com/df-mc/dragonfly/server/event"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/player/skin"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// result is everything a handler changed or reported while handling two attacks.
+type result struct {
+	records   []testhandlers.Record
+	cancelled []bool
+	errors    []string
+	counter   int
+}
+
+// attack accepts two players on the same team into a manager with the handler, and lets the first attack the second
+// twice: once with a Marker component and once without.
+func attack(t *testing.T, newHandler func(records *[]testhandlers.Record) peex.Handler) result {
+	t.Helper()
+	var res result
+	m := peex.New(peex.Config{
+		Handlers:  []peex.Handler{newHandler(&res.records)},
+		Resources: []any{&testhandlers.Bonus{N: 3}},
+		ErrorHandler: func(err peex.HandlerError) {
+			res.errors = append(res.errors, err.Err.Error())
+		},
+	})
+	counter := &testhandlers.Counter{}
+	attacker, err := m.Accept(player.New("attacker", skin.Skin{}, mgl64.Vec3{}), counter, &testhandlers.Marker{}, &testhandlers.Team{Name: "red"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	victim, err := m.Accept(player.New("victim", skin.Skin{}, mgl64.Vec3{}), &testhandlers.Team{Name: "red"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if i == 1 {
+			if _, err := attacker.RemoveComponent(&testhandlers.Marker{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ctx := event.C()
+		attacker.HandleAttackEntity(ctx, victim.Player(), new(float64), new(float64), new(bool))
+		res.cancelled = append(res.cancelled, ctx.Cancelled())
+	}
+	res.counter = counter.N
+	return res
+}
+
+func TestGeneratedHandlerMatchesReflection(t *testing.T) {
+	gen := attack(t, func(records *[]testhandlers.Record) peex.Handler {
+		return testhandlers.Generated{Prefix: "prefix ", Records: records}
+	})
+	refl := attack(t, func(records *[]testhandlers.Record) peex.Handler {
+		return testhandlers.Reflected{Prefix: "prefix ", Records: records}
+	})
+
+	if len(gen.records) != 2 || len(refl.records) != 2 {
+		t.Fatalf("handlers ran %v and %v times, expected 2", len(gen.records), len(refl.records))
+	}
+	for i := range gen.records {
+		if !gen.records[i].Generated {
+			t.Errorf("generated code was not used for attack %v", i)
+		}
+		if refl.records[i].Generated {
+			t.Errorf("generated code was used for a handler without generated code for attack %v", i)
+		}
+		gen.records[i].Generated, refl.records[i].Generated = false, false
+	}
+	if !reflect.DeepEqual(gen, refl) {
+		t.Fatalf("generated handler resulted in %+v, reflection in %+v", gen, refl)
+	}
+	want := testhandlers.Record{Player: "attacker", Session: true, Manager: true, Logger: true, Counter: 1, Marker: true, Team: "red", Victim: "red", Bonus: 3, Prefix: "prefix "}
+	if gen.records[0] != want {
+		t.Fatalf("generated handler recorded %+v, expected %+v", gen.records[0], want)
+	}
+	if gen.records[1].Marker {
+		t.Fatal("generated handler found the marker after it was removed")
+	}
+}
+
+func TestGeneratedHandlerPanicsLikeReflection(t *testing.T) {
+	handlers := map[string]peex.Handler{
+		"generated": testhandlers.Swapper{},
+		"reflected": testhandlers.ReflectedSwapper{},
+	}
+	panics := map[string]string{}
+	for name, h := range handlers {
+		m := peex.New(peex.Config{Handlers: []peex.Handler{h}})
+		s, err := m.Accept(player.New("test", skin.Skin{}, mgl64.Vec3{}), &testhandlers.Knight{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		func() {
+			defer func() {
+				panics[name] = fmt.Sprint(recover())
+			}()
+			s.HandleJump()
+		}()
+	}
+	if panics["generated"] == "<nil>" || panics["generated"] != panics["reflected"] {
+		t.Fatalf("generated handler panicked with %q, reflection with %q", panics["generated"], panics["reflected"])
+	}
+}
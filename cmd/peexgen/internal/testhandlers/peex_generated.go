@@ -0,0 +1,48 @@
+// Code generated by peexgen. DO NOT EDIT.
+
+package testhandlers
+
+import (
+	"github.com/andreashgk/peex"
+	"github.com/df-mc/dragonfly/server/event"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+func init() {
+	peex.RegisterGenerated[Generated](peex.GeneratedHandler{
+		HandleAttackEntity: func(d *peex.Dispatch, p0 *event.Context, p1 world.Entity, p2 *float64, p3 *float64, p4 *bool) {
+			newGenerated(d).HandleAttackEntity(p0, p1, p2, p3, p4)
+		},
+	}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, []int{10, 11})
+	peex.RegisterGenerated[Swapper](peex.GeneratedHandler{
+		HandleJump: func(d *peex.Dispatch) {
+			newSwapper(d).HandleJump()
+		},
+	}, []int{0}, []int{})
+}
+
+// newGenerated creates a new Generated for the dispatch of an event.
+func newGenerated(d *peex.Dispatch) *Generated {
+	h := &Generated{}
+	p := peex.Prototype[Generated](d)
+	h.Player = d.Player()
+	h.Session = d.Session()
+	h.Manager = d.Manager()
+	h.Log = d.Logger()
+	h.Errors = d.Errors()
+	h.Counter = peex.Fill(d, 5, h.Counter)
+	h.Marker = peex.Fill(d, 6, h.Marker)
+	h.Team = peex.Fill(d, 7, h.Team)
+	h.Victim = peex.FillTarget(d, 8, h.Victim)
+	h.Bonus = peex.FillResource(d, 9, h.Bonus)
+	h.Prefix = p.Prefix
+	h.Records = p.Records
+	return h
+}
+
+// newSwapper creates a new Swapper for the dispatch of an event.
+func newSwapper(d *peex.Dispatch) *Swapper {
+	h := &Swapper{}
+	h.Damageable = peex.Fill(d, 0, h.Damageable)
+	return h
+}
@@ -0,0 +1,403 @@
+// Command peexgen generates code that allows Peex to create and call handlers without using reflection, which is a lot
+// faster for events that are called often, such as HandleMove. It is meant to be used with go:generate in the package
+// that contains the handlers:
+//
+//	//go:generate go run github.com/andreashgk/peex/cmd/peexgen -type MinigameHandler,ChatHandler
+//
+// The generated code registers itself when the package is initialised, and is picked up automatically by peex.New. It
+// must be regenerated whenever the fields or event methods of a handler change. Outdated code is detected and ignored
+// by Peex, in which case reflection is used again.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andreashgk/peex"
+)
+
+const (
+	peexPath   = "github.com/andreashgk/peex"
+	playerPath = "github.com/df-mc/dragonfly/server/player"
+	slogPath   = "log/slog"
+)
+
+func main() {
+	optTypes := flag.String("type", "", "comma-separated list of handler types to generate code for")
+	optOutFile := flag.String("o", "peex_generated.go", "output file")
+	flag.Parse()
+
+	if *optTypes == "" {
+		fail("must provide at least one handler type using -type")
+	}
+
+	src := generateFile(".", strings.Split(*optTypes, ","), *optOutFile)
+	if err := os.WriteFile(*optOutFile, src, 0644); err != nil {
+		fail("error writing output file: %s", err)
+	}
+}
+
+// generateFile returns the formatted contents of the generated file for the handler types in the package in the
+// directory. The output file itself is not parsed, so that outdated generated code does not affect the new code.
+func generateFile(dir string, types []string, outFile string) []byte {
+	fs := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fs, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && info.Name() != outFile
+	}, 0)
+	if err != nil {
+		fail("error parsing package: %s", err)
+	}
+	if len(pkgs) != 1 {
+		fail("expected exactly one package in the directory, found %d", len(pkgs))
+	}
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+
+	g := &generator{fs: fs, imports: map[string]string{peexPath: "peex"}}
+	for _, name := range types {
+		g.generate(pkg, strings.TrimSpace(name))
+	}
+
+	src, err := format.Source(g.file(pkg.Name))
+	if err != nil {
+		fail("error formatting generated code: %s", err)
+	}
+	return src
+}
+
+// generator generates the code for handlers in a single package.
+type generator struct {
+	fs *token.FileSet
+	// imports maps the import paths used by the generated code to their names.
+	imports map[string]string
+
+	inits bytes.Buffer
+	funcs bytes.Buffer
+}
+
+// generate generates the code for the handler with the name.
+func (g *generator) generate(pkg *ast.Package, name string) {
+	file, spec := findType(pkg, name)
+	if spec == nil {
+		fail("could not find handler type %s", name)
+	}
+	if spec.TypeParams != nil {
+		fail("handler type %s cannot have type parameters", name)
+	}
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		fail("handler type %s must be a struct", name)
+	}
+
+	// Figure out what every field of the handler is used for, in the same way Peex does using reflection.
+	names := importNames(file)
+	var injected, copied []int
+	var setters []string
+	seen := map[string]bool{}
+	fieldNum := 0
+	for _, field := range st.Fields.List {
+		fieldNames := field.Names
+		if len(fieldNames) == 0 {
+			fieldNames = []*ast.Ident{ast.NewIdent(embeddedName(field.Type))}
+		}
+		for _, ident := range fieldNames {
+			num := fieldNum
+			fieldNum++
+
+			if field.Tag != nil {
+				tag, _ := strconv.Unquote(field.Tag.Value)
+				if _, ok := reflect.StructTag(tag).Lookup("ignore"); ok {
+					continue
+				}
+			}
+			if !ident.IsExported() {
+				continue
+			}
+
+			kind := fieldKind(field.Type, names)
+			switch kind {
+			case "query":
+				setters = append(setters, fmt.Sprintf("h.%s = peex.Fill(d, %d, h.%s)", ident.Name, num, ident.Name))
+			case "target":
+				setters = append(setters, fmt.Sprintf("h.%s = peex.FillTarget(d, %d, h.%s)", ident.Name, num, ident.Name))
+			case "resource":
+				setters = append(setters, fmt.Sprintf("h.%s = peex.FillResource(d, %d, h.%s)", ident.Name, num, ident.Name))
+			case "Player", "Session", "Manager", "Logger", "Errors":
+				// Only the first field of these types is set, the others are left empty.
+				if seen[kind] {
+					continue
+				}
+				seen[kind] = true
+				setters = append(setters, fmt.Sprintf("h.%s = d.%s()", ident.Name, kind))
+			default:
+				copied = append(copied, num)
+				setters = append(setters, fmt.Sprintf("h.%s = p.%s", ident.Name, ident.Name))
+				continue
+			}
+			injected = append(injected, num)
+		}
+	}
+
+	// Generate a function for every event the handler implements.
+	events := eventTypes()
+	var eventFuncs []string
+	for _, f := range findMethods(pkg, name) {
+		if _, ok := events[f.decl.Name.Name]; !ok {
+			continue
+		}
+		var params, args []string
+		for _, p := range f.decl.Type.Params.List {
+			typ := g.typeString(p.Type, importNames(f.file))
+			n := len(p.Names)
+			if n == 0 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				arg := "p" + strconv.Itoa(len(args))
+				params = append(params, arg+" "+typ)
+				args = append(args, arg)
+			}
+		}
+		eventFuncs = append(eventFuncs, fmt.Sprintf("%s: func(%s) {\n\t\t\tnew%s(d).%s(%s)\n\t\t},",
+			f.decl.Name.Name,
+			strings.Join(append([]string{"d *peex.Dispatch"}, params...), ", "),
+			exportedName(name),
+			f.decl.Name.Name,
+			strings.Join(args, ", "),
+		))
+	}
+	if len(eventFuncs) == 0 {
+		fail("handler type %s does not implement any events", name)
+	}
+
+	fmt.Fprintf(&g.inits, "\tpeex.RegisterGenerated[%s](peex.GeneratedHandler{\n\t\t%s\n\t}, %s, %s)\n",
+		name, strings.Join(eventFuncs, "\n\t\t"), intSlice(injected), intSlice(copied))
+
+	fmt.Fprintf(&g.funcs, "\n// new%s creates a new %s for the dispatch of an event.\n", exportedName(name), name)
+	fmt.Fprintf(&g.funcs, "func new%s(d *peex.Dispatch) *%s {\n\th := &%s{}\n", exportedName(name), name, name)
+	if len(copied) > 0 {
+		fmt.Fprintf(&g.funcs, "\tp := peex.Prototype[%s](d)\n", name)
+	}
+	for _, s := range setters {
+		fmt.Fprintf(&g.funcs, "\t%s\n", s)
+	}
+	g.funcs.WriteString("\treturn h\n}\n")
+}
+
+// file returns the contents of the generated file.
+func (g *generator) file(pkgName string) []byte {
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "// Code generated by peexgen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkgName)
+	for _, path := range paths {
+		if name := g.imports[path]; name != path[strings.LastIndex(path, "/")+1:] {
+			fmt.Fprintf(b, "\t%s %q\n", name, path)
+			continue
+		}
+		fmt.Fprintf(b, "\t%q\n", path)
+	}
+	fmt.Fprintf(b, ")\n\nfunc init() {\n%s}\n", g.inits.String())
+	b.Write(g.funcs.Bytes())
+	return b.Bytes()
+}
+
+// typeString returns the type expression as it is written in the source, and adds the imports of all the packages it
+// uses to the generated file.
+func (g *generator) typeString(expr ast.Expr, names map[string]string) string {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok {
+			for path, name := range names {
+				if name == x.Name {
+					g.imports[path] = name
+				}
+			}
+		}
+		return false
+	})
+
+	b := &bytes.Buffer{}
+	if err := printer.Fprint(b, g.fs, expr); err != nil {
+		fail("error printing type: %s", err)
+	}
+	return b.String()
+}
+
+// fieldKind returns what a handler field is used for by Peex based on its type: query, target, resource, Player,
+// Session, Manager, Logger or Errors. An empty string is returned for fields that are copied.
+func fieldKind(expr ast.Expr, names map[string]string) string {
+	isSelector := func(expr ast.Expr, path, sel string) bool {
+		s, ok := expr.(*ast.SelectorExpr)
+		if !ok || s.Sel.Name != sel {
+			return false
+		}
+		x, ok := s.X.(*ast.Ident)
+		return ok && x.Name == names[path]
+	}
+
+	if star, ok := expr.(*ast.StarExpr); ok {
+		switch {
+		case isSelector(star.X, playerPath, "Player"):
+			return "Player"
+		case isSelector(star.X, peexPath, "Session"):
+			return "Session"
+		case isSelector(star.X, peexPath, "Manager"):
+			return "Manager"
+		case isSelector(star.X, slogPath, "Logger"):
+			return "Logger"
+		}
+		return ""
+	}
+	if isSelector(expr, peexPath, "Errors") {
+		return "Errors"
+	}
+
+	// Queries are always generic types.
+	switch x := expr.(type) {
+	case *ast.IndexExpr:
+		expr = x.X
+	case *ast.IndexListExpr:
+		expr = x.X
+	default:
+		return ""
+	}
+	for _, query := range []string{"Query", "Mut", "Option", "With", "Keyed"} {
+		if isSelector(expr, peexPath, query) {
+			return "query"
+		}
+	}
+	if isSelector(expr, peexPath, "Target") {
+		return "target"
+	}
+	if isSelector(expr, peexPath, "Res") {
+		return "resource"
+	}
+	return ""
+}
+
+// eventTypes returns the names of all events that can be generated, which are the fields of peex.GeneratedHandler.
+func eventTypes() map[string]struct{} {
+	t := reflect.TypeOf(peex.GeneratedHandler{})
+	events := make(map[string]struct{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		events[t.Field(i).Name] = struct{}{}
+	}
+	return events
+}
+
+// findType finds the declaration of a type in the package, along with the file it is declared in.
+func findType(pkg *ast.Package, name string) (*ast.File, *ast.TypeSpec) {
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				if typ := spec.(*ast.TypeSpec); typ.Name.Name == name {
+					return file, typ
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+type method struct {
+	file *ast.File
+	decl *ast.FuncDecl
+}
+
+// findMethods finds all the methods declared on a type or a pointer to it, sorted by name.
+func findMethods(pkg *ast.Package, name string) []method {
+	var methods []method
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			f, ok := decl.(*ast.FuncDecl)
+			if !ok || f.Recv == nil || len(f.Recv.List) == 0 {
+				continue
+			}
+			recv := f.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			if ident, ok := recv.(*ast.Ident); ok && ident.Name == name {
+				methods = append(methods, method{file: file, decl: f})
+			}
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].decl.Name.Name < methods[j].decl.Name.Name
+	})
+	return methods
+}
+
+// importNames maps the import paths of a file to the names they are referred to by.
+func importNames(file *ast.File) map[string]string {
+	names := map[string]string{}
+	for _, imp := range file.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		names[path] = name
+	}
+	return names
+}
+
+// embeddedName returns the name of an embedded field with the type.
+func embeddedName(expr ast.Expr) string {
+	switch x := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(x.X)
+	case *ast.SelectorExpr:
+		return x.Sel.Name
+	case *ast.IndexExpr:
+		return embeddedName(x.X)
+	case *ast.IndexListExpr:
+		return embeddedName(x.X)
+	case *ast.Ident:
+		return x.Name
+	}
+	return ""
+}
+
+// exportedName returns the name with the first letter in upper case, so it can be used after a prefix.
+func exportedName(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func intSlice(s []int) string {
+	parts := make([]string, len(s))
+	for i, v := range s {
+		parts[i] = strconv.Itoa(v)
+	}
+	return "[]int{" + strings.Join(parts, ", ") + "}"
+}
+
+func fail(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	os.Exit(1)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestGeneratedCodeIsUpToDate(t *testing.T) {
+	const dir = "internal/testhandlers"
+	want, err := os.ReadFile(dir + "/peex_generated.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := generateFile(dir, []string{"Generated", "Swapper"}, "peex_generated.go")
+	if !bytes.Equal(got, want) {
+		t.Fatalf("generated code does not match %s/peex_generated.go, run go generate in %s:\n%s", dir, dir, got)
+	}
+}
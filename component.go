@@ -3,6 +3,7 @@ package peex
 import (
 	"github.com/df-mc/dragonfly/server/player"
 	"reflect"
+	"slices"
 )
 
 // Component represents some data type that can be stored in a player session. There can only be one component of each
@@ -38,6 +39,30 @@ func ComponentFromSession[T Component](s *Session) (T, bool) {
 	return comp.(T), true
 }
 
+// AllComponents returns every component in the session that implements the interface I, ordered by the time their
+// component types were first used. This can be used to handle components of multiple types at once:
+//
+//	for _, d := range peex.AllComponents[Damageable](s) {
+//		d.Damage(5)
+//	}
+func AllComponents[I any](s *Session) []I {
+	s.componentsMapMu.RLock()
+	defer s.componentsMapMu.RUnlock()
+
+	ids := make([]componentId, 0, len(s.components))
+	for id, c := range s.components {
+		if _, ok := c.(I); ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	comps := make([]I, len(ids))
+	for i, id := range ids {
+		comps[i] = s.components[id].(I)
+	}
+	return comps
+}
+
 /// Internal component logic
 /// ------------------------
 
@@ -51,10 +76,100 @@ func (m *Manager) getComponentId(c Component) componentId {
 }
 
 func (m *Manager) getComponentIdRefl(t reflect.Type) componentId {
+	if id, ok := m.lookupComponentId(t); ok {
+		return id
+	}
+
+	m.componentMu.Lock()
+	defer m.componentMu.Unlock()
+	// The component type might have been registered by another goroutine in the meantime.
 	id, ok := m.componentIdTable[t]
 	if !ok {
 		m.componentIdTable[t], id = m.componentNextId, m.componentNextId
+		m.componentTypes[id] = t
 		m.componentNextId++
 	}
 	return id
 }
+
+// lookupComponentId returns the ID of a component type, without creating one if the type has none.
+func (m *Manager) lookupComponentId(t reflect.Type) (componentId, bool) {
+	m.componentMu.RLock()
+	id, ok := m.componentIdTable[t]
+	m.componentMu.RUnlock()
+	return id, ok
+}
+
+// componentName returns the name of the type of component with the ID.
+func (m *Manager) componentName(id componentId) string {
+	m.componentMu.RLock()
+	t := m.componentTypes[id]
+	m.componentMu.RUnlock()
+	return t.String()
+}
+
+// componentType returns the type of component with the ID.
+func (m *Manager) componentType(id componentId) reflect.Type {
+	m.componentMu.RLock()
+	t := m.componentTypes[id]
+	m.componentMu.RUnlock()
+	return t
+}
+
+// isInterface returns whether the component ID belongs to an interface type, which is queried by looking for a component
+// that implements the interface.
+func (m *Manager) isInterface(id componentId) bool {
+	t := m.componentType(id)
+	return t != nil && t.Kind() == reflect.Interface
+}
+
+// queryComponent returns the component with the ID from the session, along with the ID it is actually stored under. If
+// the ID belongs to an interface type, the component with the lowest ID that implements the interface is returned. The
+// components lock must be held while calling this method.
+func (s *Session) queryComponent(id componentId) (componentId, Component, bool) {
+	if c, ok := s.components[id]; ok {
+		return id, c, true
+	}
+	if !s.m.isInterface(id) {
+		return 0, nil, false
+	}
+
+	// Multiple goroutines may be holding the read lock of the components, so the cache needs its own lock.
+	s.interfacesMu.Lock()
+	defer s.interfacesMu.Unlock()
+	match, ok := s.interfaces[id]
+	if !ok {
+		match = s.resolveInterface(s.m.componentType(id))
+		if s.interfaces == nil {
+			s.interfaces = map[componentId]interfaceMatch{}
+		}
+		s.interfaces[id] = match
+	}
+	if !match.ok {
+		return 0, nil, false
+	}
+	return match.id, s.components[match.id], true
+}
+
+// interfaceMatch is the result of looking for a component that implements an interface type.
+type interfaceMatch struct {
+	id componentId
+	ok bool
+}
+
+// resolveInterface finds the component with the lowest ID that implements the interface type.
+func (s *Session) resolveInterface(t reflect.Type) interfaceMatch {
+	var match interfaceMatch
+	for id, c := range s.components {
+		if (!match.ok || id < match.id) && reflect.TypeOf(c).Implements(t) {
+			match = interfaceMatch{id: id, ok: true}
+		}
+	}
+	return match
+}
+
+// componentsChanged must be called when a component is added to or removed from the session, so that interface queries
+// are resolved again. The components lock must be held for writing.
+func (s *Session) componentsChanged() {
+	s.interfaces = nil
+}
@@ -1,18 +1,67 @@
 package peex
 
-import "github.com/df-mc/dragonfly/server"
+import (
+	"github.com/df-mc/dragonfly/server"
+	"log/slog"
+	"time"
+)
 
 // Config is a struct passed to the New function when creating a new Manager. It allows for customizing several aspects
 // such as specifying handlers and component providers. Many of these cannot be modified after the manager has been
 // created.
 type Config struct {
 	// Logger allows for an optional logger to be supplied. This will log things such as errors when saving components
-	// when a player is leaving.
+	// when a player is leaving. Log is used instead if it is set.
 	Logger server.Logger
+	// Log allows for an optional structured logger to be supplied. Every record logged by Peex has attributes such as
+	// the UUID and name of the player and the type of the handler or component involved. This logger is also passed to
+	// handlers with a *slog.Logger field.
+	Log *slog.Logger
 	// Handlers contains all the handlers that will run during the lifetime of the manager. These will always be active,
 	// but can be controlled through adding or removing components from users.
 	Handlers []Handler
+	// GlobalHandlers contains handlers that handle the events of every player, regardless of their components. They also
+	// handle the events of players without a session that are observed using Manager.Observe, in which case their
+	// *Session field is nil. Global handlers run before the other handlers, and cannot have any queries.
+	GlobalHandlers []Handler
+	// Groups contains named groups of handlers and systems, which can be disabled globally using
+	// Manager.SetGroupEnabled or for a single session using Session.DisableGroup. Handlers are identified by their type,
+	// so any value of the same type as the registered handler can be used. A handler may be in multiple groups, in which
+	// case it only runs if all of them are enabled. At most 64 groups can be specified.
+	Groups map[string][]Handler
+	// Resources contains values shared by the whole manager, such as a database, which are injected into handlers and
+	// query functions with a Res parameter of the same type. Only one resource of every type may be provided.
+	Resources []any
+	// Systems contains all the systems that run periodically for every session that matches their queries. They run in
+	// the order they are provided every time Manager.Tick is called, or at a fixed rate using Manager.RunSystems.
+	Systems []System
 	// Providers allows for passing of a list of ComponentProviders which can load & save components for players at
 	// runtime. The providers must be wrapped in a ProviderWrapper using the WrapProvider function.
 	Providers []ComponentProvider
+	// KeyedProviders works the same as Providers, but for keyed components. The providers must be wrapped in a
+	// KeyedProviderWrapper using the WrapKeyedProvider function.
+	KeyedProviders []KeyedComponentProvider
+	// RecoverPanics makes the manager recover from panics in handlers, instead of letting them propagate to the
+	// goroutine of the player. Recovered panics are logged along with the stack trace of the handler.
+	RecoverPanics bool
+	// ErrorHandler is called for every error that a handler reported through its Errors field. If no error handler is
+	// set, these errors are logged instead. This function runs after the handler has returned and the session has been
+	// unlocked, so it may query the session and insert or remove components.
+	ErrorHandler func(err HandlerError)
+	// Metrics allows for an optional metrics implementation to be supplied, which will receive measurements such as
+	// how long handlers take to run and how many sessions are online. PrometheusMetrics can be used to export these
+	// in the Prometheus text format. No measurements are made if this is nil.
+	Metrics Metrics
+	// Tracer allows for an optional tracer to be supplied, which creates spans around handling events, loading & saving
+	// components and queries. A NopTracer is used if this is nil.
+	Tracer Tracer
+	// SlowHandlerThreshold enables the slow handler watchdog if it is more than zero. Any handler that takes longer than
+	// this to handle an event will be logged while it is still running. The stack of its goroutine is included at most
+	// once per minute for every handler, as collecting it briefly stops all goroutines.
+	// Statistics about the time handlers take can then be retrieved using Manager.HandlerStats.
+	SlowHandlerThreshold time.Duration
+	// MaxHandlerPanics is the amount of times a handler may panic before it gets disabled for every session. A disabled
+	// handler can be enabled again using Manager.EnableHandler. Handlers are never disabled if this is zero. Only has
+	// an effect if RecoverPanics is enabled.
+	MaxHandlerPanics int
 }
@@ -0,0 +1,140 @@
+package peex
+
+import (
+	"github.com/df-mc/dragonfly/server/event"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Emit emits a custom event for the session, which is handled by every handler with a matching method in the same way as
+// the events of player.Handler, including queries and the order of the handlers. A handler handles a custom event of a
+// type such as GameStart if it has a HandleGameStart method, which takes the event as its only parameter or takes an
+// *event.Context followed by the event:
+//
+//	func (h MinigameHandler) HandleGameStart(ctx *event.Context, e GameStart) {
+//		// ...
+//	}
+//
+// Handlers with these methods are detected when the Manager is created. Emit returns whether the event was cancelled by
+// one of the handlers, either through the context or by reporting an error created using Cancel.
+// Emit must not be called while the session is locked, such as from a handler or query function for the same session.
+func Emit(s *Session, e any) (cancelled bool) {
+	customMu.RLock()
+	ce, ok := customEvents[reflect.TypeOf(e)]
+	customMu.RUnlock()
+	if !ok {
+		// No handler handles events of this type.
+		return false
+	}
+
+	ctx := event.C()
+	eventVal := reflect.ValueOf(e)
+	s.handleEvent(ce.id, ctx, nil, func(h Handler) {
+		m, ok := ce.methods[reflect.TypeOf(h)]
+		if !ok {
+			// The handler was registered after the event was emitted.
+			return
+		}
+		method := reflect.ValueOf(h).Method(m.index)
+		if m.ctx {
+			method.Call([]reflect.Value{reflect.ValueOf(ctx), eventVal})
+			return
+		}
+		method.Call([]reflect.Value{eventVal})
+	}, nil)
+	return ctx.Cancelled()
+}
+
+/// Internal custom event logic
+/// ---------------------------
+
+// customEvent is a type of custom event that is handled by at least one handler.
+type customEvent struct {
+	id   eventId
+	name string
+	// methods contains the method that handles the event for every handler type. The map is never modified once it is
+	// stored in customEvents, so that it can be used without holding the lock.
+	methods map[reflect.Type]customMethod
+}
+
+// customMethod is the method of a handler type that handles a custom event.
+type customMethod struct {
+	// index is the index of the method in the method set of the handler type.
+	index int
+	// ctx is true if the method takes an *event.Context before the event.
+	ctx bool
+}
+
+var (
+	// customEvents contains the custom event types handled by any handler of any manager. The IDs of these events
+	// follow those of the events of player.Handler.
+	customEvents     = map[reflect.Type]customEvent{}
+	customEventNames = map[eventId]string{}
+	customNextId     = eventId(len(allEvents))
+	customMu         sync.RWMutex
+)
+
+var contextType = reflect.TypeOf((*event.Context)(nil))
+
+// getCustomEvents returns the custom events that a handler type handles, registering any event types that were not
+// used before.
+func getCustomEvents(t reflect.Type) map[eventId]struct{} {
+	events := map[eventId]struct{}{}
+	for i := 0; i < t.NumMethod(); i++ {
+		method := t.Method(i)
+		name, ok := strings.CutPrefix(method.Name, "Handle")
+		if !ok {
+			continue
+		}
+		if _, ok := allEvents["event"+name]; ok {
+			continue
+		}
+
+		// The first parameter of the method type is the receiver.
+		mt := method.Type
+		if mt.NumOut() != 0 || mt.NumIn() < 2 || mt.NumIn() > 3 || (mt.NumIn() == 3 && mt.In(1) != contextType) {
+			continue
+		}
+		et := mt.In(mt.NumIn() - 1)
+		if et.Name() != name && (et.Kind() != reflect.Pointer || et.Elem().Name() != name) {
+			continue
+		}
+		events[registerCustomEvent(et, name, t, customMethod{index: i, ctx: mt.NumIn() == 3})] = struct{}{}
+	}
+	return events
+}
+
+// registerCustomEvent returns the ID of the custom event type, creating one if it does not exist yet. The method handles
+// the event for the handler type, and is stored so that it does not need to be looked up every time the event is emitted.
+func registerCustomEvent(t reflect.Type, name string, handlerType reflect.Type, method customMethod) eventId {
+	customMu.Lock()
+	defer customMu.Unlock()
+	ce, ok := customEvents[t]
+	if !ok {
+		ce = customEvent{id: customNextId, name: name}
+		customNextId++
+		customEventNames[ce.id] = name
+	}
+	methods := make(map[reflect.Type]customMethod, len(ce.methods)+1)
+	for typ, m := range ce.methods {
+		methods[typ] = m
+	}
+	methods[handlerType] = method
+	ce.methods = methods
+	customEvents[t] = ce
+	return ce.id
+}
+
+// isCustomEvent returns whether the event ID belongs to a custom event.
+func isCustomEvent(id eventId) bool {
+	return id >= eventId(len(allEvents)) && id != eventTick
+}
+
+// customEventName returns the name of the custom event with the ID.
+func customEventName(id eventId) (string, bool) {
+	customMu.RLock()
+	name, ok := customEventNames[id]
+	customMu.RUnlock()
+	return name, ok
+}
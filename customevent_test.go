@@ -0,0 +1,117 @@
+package peex_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/andreashgk/peex"
+	"github.com/df-mc/dragonfly/server/event"
+)
+
+type GameStart struct{ Round int }
+
+type Unhandled struct{}
+
+// GameStartHandler records the rounds it saw. A negative round cancels the event through the context, round zero
+// reports a cancelling error and round 99 reports an error that does not cancel the event.
+type GameStartHandler struct {
+	Counter peex.Query[*Counter]
+	Errors  peex.Errors
+	Rounds  *[]int
+}
+
+func (h GameStartHandler) HandleGameStart(ctx *event.Context, e GameStart) {
+	*h.Rounds = append(*h.Rounds, e.Round)
+	switch e.Round {
+	case -1:
+		ctx.Cancel()
+	case 0:
+		h.Errors.Report(peex.Cancel(errors.New("no round")))
+	case 99:
+		h.Errors.Report(errors.New("last round"))
+	}
+}
+
+// GameStartNoContextHandler records the rounds it saw, and handles the event without a context.
+type GameStartNoContextHandler struct {
+	Rounds *[]int
+}
+
+func (h GameStartNoContextHandler) HandleGameStart(e GameStart) {
+	*h.Rounds = append(*h.Rounds, -e.Round)
+}
+
+// newGameStartManager creates a manager with both GameStart handlers, and returns the rounds they saw and the errors
+// they reported.
+func newGameStartManager() (*peex.Manager, *[]int, *[]error) {
+	rounds, errs := &[]int{}, &[]error{}
+	m := peex.New(peex.Config{
+		Handlers: []peex.Handler{GameStartHandler{Rounds: rounds}, GameStartNoContextHandler{Rounds: rounds}},
+		ErrorHandler: func(err peex.HandlerError) {
+			*errs = append(*errs, err.Err)
+		},
+	})
+	return m, rounds, errs
+}
+
+func TestEmit(t *testing.T) {
+	m, rounds, _ := newGameStartManager()
+	s := accept(t, m, &Counter{})
+	without := accept(t, m)
+
+	withTimeout(t, func() {
+		if peex.Emit(s, GameStart{Round: 1}) {
+			t.Error("event was cancelled")
+		}
+		peex.Emit(without, GameStart{Round: 2})
+	})
+	if len(*rounds) != 3 || (*rounds)[0] != 1 || (*rounds)[1] != -1 || (*rounds)[2] != -2 {
+		t.Fatalf("handlers saw rounds %v, expected [1 -1 -2]", *rounds)
+	}
+	if peex.Emit(s, Unhandled{}) {
+		t.Fatal("event without handlers was cancelled")
+	}
+}
+
+func TestEmitCancel(t *testing.T) {
+	tests := map[string]struct {
+		round     int
+		cancelled bool
+		errors    int
+	}{
+		"context":      {round: -1, cancelled: true},
+		"cancel error": {round: 0, cancelled: true, errors: 1},
+		"error":        {round: 99, cancelled: false, errors: 1},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, _, errs := newGameStartManager()
+			s := accept(t, m, &Counter{})
+
+			var cancelled bool
+			withTimeout(t, func() { cancelled = peex.Emit(s, GameStart{Round: test.round}) })
+			if cancelled != test.cancelled {
+				t.Errorf("Emit returned %v, expected %v", cancelled, test.cancelled)
+			}
+			if len(*errs) != test.errors {
+				t.Errorf("%v errors were reported, expected %v", len(*errs), test.errors)
+			}
+		})
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	m, rounds, _ := newGameStartManager()
+	accept(t, m, &Counter{})
+	accept(t, m, &Counter{})
+	accept(t, m)
+
+	var cancelled int
+	withTimeout(t, func() { cancelled = m.Broadcast(GameStart{Round: -1}) })
+	if cancelled != 2 {
+		t.Fatalf("event was cancelled for %v sessions, expected 2", cancelled)
+	}
+	if len(*rounds) != 5 {
+		t.Fatalf("handlers handled the event %v times, expected 5", len(*rounds))
+	}
+}
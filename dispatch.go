@@ -0,0 +1,192 @@
+package peex
+
+import (
+	"github.com/df-mc/dragonfly/server/player"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// Dispatch is passed to the code generated by cmd/peexgen when a handler handles an event. It provides the values that
+// would otherwise be set using reflection. It is only valid for the duration of the event, and should not be used
+// outside of generated code.
+type Dispatch struct {
+	s    *Session
+	ts   *Session
+	info *handlerInfo
+
+	report *errorReport
+	writes []pendingWrite
+}
+
+// Session returns the Session the event is handled for. It is nil for global handlers handling the events of a player
+// without a session.
+func (d *Dispatch) Session() *Session {
+	if d.s.detached {
+		return nil
+	}
+	return d.s
+}
+
+// Player returns the player that owns the Session.
+func (d *Dispatch) Player() *player.Player {
+	return d.s.Player()
+}
+
+// Manager returns the Manager of the Session.
+func (d *Dispatch) Manager() *Manager {
+	return d.s.m
+}
+
+// Logger returns the logger that is passed to handlers with a *slog.Logger field.
+func (d *Dispatch) Logger() *slog.Logger {
+	return d.s.log.With("handler", d.info.name)
+}
+
+// Errors returns the Errors that is passed to handlers with an Errors field.
+func (d *Dispatch) Errors() Errors {
+	if d.report == nil {
+		d.report = &errorReport{}
+	}
+	return Errors{r: d.report}
+}
+
+// Prototype returns the handler as it was registered in the Config, which is used to copy the fields that are not set
+// by Peex. T must be the struct type of the handler, even if the handler was registered as a pointer.
+func Prototype[T Handler](d *Dispatch) T {
+	switch h := d.info.h.(type) {
+	case T:
+		return h
+	case *T:
+		return *h
+	}
+	panic("handler prototype is not of the generated type")
+}
+
+// Fill returns the query q with the value it has in the handler field with the index. The query is returned unchanged
+// if the component it queries is not present.
+func Fill[Q queryType](d *Dispatch, field int, q Q) Q {
+	for _, compQuery := range d.info.components {
+		if compQuery.fieldNum != field {
+			continue
+		}
+		if cId, c, ok := d.s.queryComponent(compQuery.id); ok {
+			q = q.set(c).(Q)
+			d.writes = trackWrite(d.writes, d.s, cId, q)
+		}
+		break
+	}
+	return q
+}
+
+// FillTarget returns the target t with the value it has in the handler field with the index.
+func FillTarget[T targetType](d *Dispatch, field int, t T) T {
+	for _, targetQuery := range d.info.targets {
+		if targetQuery.fieldNum != field {
+			continue
+		}
+		query := t.inner()
+		if cId, c, ok := d.ts.queryComponent(targetQuery.id); ok {
+			query = query.set(c)
+			d.writes = trackWrite(d.writes, d.ts, cId, query)
+		}
+		return t.setTarget(d.ts, query).(T)
+	}
+	return t
+}
+
+// FillResource returns the resource r with the value of the resource in the handler field with the index.
+func FillResource[R resourceType](d *Dispatch, field int, r R) R {
+	for _, rf := range d.info.resources {
+		if rf.fieldNum == field {
+			return r.setResource(rf.res.v.Load()).(R)
+		}
+	}
+	return r
+}
+
+// RegisterGenerated registers the code generated by cmd/peexgen for the handler type T. Managers created afterwards
+// will use it for handlers of type T or *T instead of reflection. Injected contains the indices of the fields that are
+// set from the Session, and copied the indices of the fields that are copied from the registered handler. If these do
+// not match the fields Peex finds using reflection, the generated code is assumed to be outdated and is not used.
+// This function should only be called by generated code.
+func RegisterGenerated[T Handler](g GeneratedHandler, injected, copied []int) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	gen := generatedHandler{
+		h:        g,
+		injected: sortedInts(injected),
+		copied:   sortedInts(copied),
+	}
+
+	generatedMu.Lock()
+	generatedHandlers[t] = gen
+	generatedHandlers[reflect.PointerTo(t)] = gen
+	generatedMu.Unlock()
+}
+
+/// Internal dispatch logic
+/// -----------------------
+
+var (
+	generatedMu       sync.Mutex
+	generatedHandlers = map[reflect.Type]generatedHandler{}
+)
+
+// generatedHandler is the generated code registered for a handler type.
+type generatedHandler struct {
+	h        GeneratedHandler
+	injected []int
+	copied   []int
+}
+
+// generatedHandler returns the generated code for a handler, if it was registered and still matches the fields of the
+// handler. Nil is returned otherwise.
+func (m *Manager) generatedHandler(info handlerInfo) *GeneratedHandler {
+	generatedMu.Lock()
+	gen, ok := generatedHandlers[info.typ]
+	generatedMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	var injected []int
+	for _, q := range info.components {
+		injected = append(injected, q.fieldNum)
+	}
+	for _, q := range info.targets {
+		injected = append(injected, q.fieldNum)
+	}
+	for _, rf := range info.resources {
+		injected = append(injected, rf.fieldNum)
+	}
+	for _, field := range []int{info.playerField, info.sessionField, info.managerField, info.errorsField, info.loggerField} {
+		if field != -1 {
+			injected = append(injected, field)
+		}
+	}
+	if !slices.Equal(sortedInts(injected), gen.injected) || !slices.Equal(sortedInts(info.copyFields), gen.copied) {
+		m.log.Warn("generated code for handler is outdated, falling back to reflection", "handler", info.name)
+		return nil
+	}
+
+	// Every event the handler implements must also have a generated function. Custom events are not generated.
+	v := reflect.ValueOf(gen.h)
+	for id := range info.events {
+		if isCustomEvent(id) {
+			continue
+		}
+		if v.FieldByName("Handle" + eventName(id)).IsNil() {
+			m.log.Warn("generated code for handler is outdated, falling back to reflection", "handler", info.name, "event", eventName(id))
+			return nil
+		}
+	}
+	return &gen.h
+}
+
+// sortedInts returns a sorted copy of the slice.
+func sortedInts(s []int) []int {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
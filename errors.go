@@ -0,0 +1,118 @@
+package peex
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors can be added as a field to a handler to report errors that occurred while handling an event. Reported errors
+// are passed to the ErrorHandler specified in the Config once the handler returns. An error wrapped using Cancel will
+// also cancel the event, if the event can be cancelled.
+type Errors struct {
+	r *errorReport
+}
+
+// Report reports an error that occurred in the handler. Nil errors are ignored.
+func (e Errors) Report(err error) {
+	if err == nil || e.r == nil {
+		return
+	}
+	e.r.errs = append(e.r.errs, err)
+}
+
+// CancelError is an error that cancels the event it was reported in. It can be created using Cancel.
+type CancelError struct {
+	Err error
+}
+
+// Cancel wraps an error in a CancelError, so that the event gets cancelled when the error is reported.
+func Cancel(err error) error {
+	return CancelError{Err: err}
+}
+
+// Error ...
+func (e CancelError) Error() string {
+	if e.Err == nil {
+		return "event cancelled"
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e CancelError) Unwrap() error {
+	return e.Err
+}
+
+// HandlerError is an error that was reported by a handler, along with the context in which it occurred.
+type HandlerError struct {
+	// Session is the session of the player that the event was handled for. It is nil if the error was reported by a
+	// global handler for a player without a session.
+	Session *Session
+	// Handler is the handler as it was registered in the Config.
+	Handler Handler
+	// Event is the name of the event that was being handled, such as Move for HandleMove.
+	Event string
+	// Err is the error that was reported.
+	Err error
+}
+
+// Error ...
+func (e HandlerError) Error() string {
+	return fmt.Sprintf("error in handler %T while handling %s: %s", e.Handler, e.Event, e.Err)
+}
+
+// Unwrap returns the error that was reported by the handler.
+func (e HandlerError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is an error that is returned when a query function panicked while running in parallel.
+type PanicError struct {
+	// Session is the session the query function was running on.
+	Session *Session
+	// Value is the value that was recovered from the panic.
+	Value any
+	// Stack is the stack trace of the goroutine at the time of the panic.
+	Stack []byte
+}
+
+// Error ...
+func (e PanicError) Error() string {
+	return fmt.Sprintf("query panicked for session %s: %v", e.Session.id, e.Value)
+}
+
+/// Internal error logic
+/// --------------------
+
+// errorReport stores the errors reported through an Errors field during a single event.
+type errorReport struct {
+	errs []error
+}
+
+// handleErrors passes the errors reported by a handler to the error handler, and returns whether any of the errors
+// requested the event to be cancelled.
+func (m *Manager) handleErrors(s *Session, eventId eventId, info handlerInfo, r *errorReport) (cancel bool) {
+	session := s
+	if s.detached {
+		// Players without a session are only handled by global handlers, which receive no session either.
+		session = nil
+	}
+	for _, err := range r.errs {
+		if errors.As(err, &CancelError{}) {
+			cancel = true
+		}
+
+		herr := HandlerError{
+			Session: session,
+			Handler: info.h,
+			Event:   eventName(eventId),
+			Err:     err,
+		}
+		if m.errorHandler != nil {
+			m.errorHandler(herr)
+		} else {
+			s.log.Error("error in handler", "handler", info.name, "event", herr.Event, "err", err)
+		}
+	}
+	return cancel
+}
@@ -0,0 +1,67 @@
+package peex_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/andreashgk/peex"
+)
+
+// FailingHandler increments the counter of the session and reports an error for every GameStart event.
+type FailingHandler struct {
+	Counter peex.Mut[*Counter]
+	Errors  peex.Errors
+}
+
+func (h FailingHandler) HandleGameStart(GameStart) {
+	h.Counter.Load().N++
+	h.Errors.Report(errors.New("game failed to start"))
+}
+
+// FailingSystem increments the counter of the session and reports an error every tick.
+type FailingSystem struct {
+	Counter peex.Mut[*Counter]
+	Errors  peex.Errors
+}
+
+func (s FailingSystem) Tick(time.Duration) {
+	s.Counter.Load().N++
+	s.Errors.Report(errors.New("tick failed"))
+}
+
+// markOnError returns an error handler that inserts a Marker into the session of every error.
+func markOnError(t *testing.T) func(err peex.HandlerError) {
+	return func(err peex.HandlerError) {
+		if err.Session == nil {
+			t.Error("error has no session")
+			return
+		}
+		if c, ok := err.Session.Component(&Counter{}); !ok || c.(*Counter).N != 1 {
+			t.Error("error handler does not see the changes of the handler")
+		}
+		if e := err.Session.InsertComponent(&Marker{}); e != nil {
+			t.Error(e)
+		}
+	}
+}
+
+func TestErrorHandlerCanModifySession(t *testing.T) {
+	m := peex.New(peex.Config{Handlers: []peex.Handler{FailingHandler{}}, ErrorHandler: markOnError(t)})
+	s := accept(t, m, &Counter{})
+
+	withTimeout(t, func() { peex.Emit(s, GameStart{}) })
+	if !hasComponent(s, &Marker{}) {
+		t.Fatal("error handler did not insert a component")
+	}
+}
+
+func TestSystemErrorHandlerCanModifySession(t *testing.T) {
+	m := peex.New(peex.Config{Systems: []peex.System{FailingSystem{}}, ErrorHandler: markOnError(t)})
+	s := accept(t, m, &Counter{})
+
+	withTimeout(t, func() { m.Tick(time.Second / 20) })
+	if !hasComponent(s, &Marker{}) {
+		t.Fatal("error handler did not insert a component")
+	}
+}
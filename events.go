@@ -192,6 +192,43 @@ var allEvents = map[string]eventId{
 	"eventLecternPageTurn":  eventLecternPageTurn,
 }
 
+// GeneratedHandler contains functions that handle events for a single handler type without using reflection. It is
+// created by code generated using cmd/peexgen and passed to RegisterGenerated. It should not be created manually.
+type GeneratedHandler struct {
+	HandleMove             func(d *Dispatch, ctx *event.Context, newPos mgl64.Vec3, newYaw, newPitch float64)
+	HandleJump             func(d *Dispatch)
+	HandleTeleport         func(d *Dispatch, ctx *event.Context, pos mgl64.Vec3)
+	HandleChangeWorld      func(d *Dispatch, before, after *world.World)
+	HandleToggleSprint     func(d *Dispatch, ctx *event.Context, after bool)
+	HandleToggleSneak      func(d *Dispatch, ctx *event.Context, after bool)
+	HandleChat             func(d *Dispatch, ctx *event.Context, message *string)
+	HandleFoodLoss         func(d *Dispatch, ctx *event.Context, from int, to *int)
+	HandleHeal             func(d *Dispatch, ctx *event.Context, health *float64, src world.HealingSource)
+	HandleHurt             func(d *Dispatch, ctx *event.Context, damage *float64, attackImmunity *time.Duration, src world.DamageSource)
+	HandleDeath            func(d *Dispatch, src world.DamageSource, keepInv *bool)
+	HandleRespawn          func(d *Dispatch, pos *mgl64.Vec3, w **world.World)
+	HandleSkinChange       func(d *Dispatch, ctx *event.Context, skin *skin.Skin)
+	HandleStartBreak       func(d *Dispatch, ctx *event.Context, pos cube.Pos)
+	HandleBlockBreak       func(d *Dispatch, ctx *event.Context, pos cube.Pos, drops *[]item.Stack, xp *int)
+	HandleBlockPlace       func(d *Dispatch, ctx *event.Context, pos cube.Pos, b world.Block)
+	HandleBlockPick        func(d *Dispatch, ctx *event.Context, pos cube.Pos, b world.Block)
+	HandleItemUse          func(d *Dispatch, ctx *event.Context)
+	HandleItemUseOnBlock   func(d *Dispatch, ctx *event.Context, pos cube.Pos, face cube.Face, clickPos mgl64.Vec3)
+	HandleItemUseOnEntity  func(d *Dispatch, ctx *event.Context, e world.Entity)
+	HandleItemConsume      func(d *Dispatch, ctx *event.Context, item item.Stack)
+	HandleAttackEntity     func(d *Dispatch, ctx *event.Context, e world.Entity, force, height *float64, critical *bool)
+	HandleExperienceGain   func(d *Dispatch, ctx *event.Context, amount *int)
+	HandlePunchAir         func(d *Dispatch, ctx *event.Context)
+	HandleSignEdit         func(d *Dispatch, ctx *event.Context, frontSide bool, oldText, newText string)
+	HandleItemDamage       func(d *Dispatch, ctx *event.Context, i item.Stack, damage int)
+	HandleItemPickup       func(d *Dispatch, ctx *event.Context, i *item.Stack)
+	HandleItemDrop         func(d *Dispatch, ctx *event.Context, e world.Entity)
+	HandleTransfer         func(d *Dispatch, ctx *event.Context, addr *net.UDPAddr)
+	HandleCommandExecution func(d *Dispatch, ctx *event.Context, command cmd.Command, args []string)
+	HandleQuit             func(d *Dispatch)
+	HandleLecternPageTurn  func(d *Dispatch, ctx *event.Context, pos cube.Pos, oldPage int, newPage *int)
+}
+
 type eventMoveHandler interface {
 	HandleMove(ctx *event.Context, newPos mgl64.Vec3, newYaw, newPitch float64)
 }
@@ -321,194 +358,258 @@ type eventLecternPageTurnHandler interface {
 }
 
 func (s *Session) HandleMove(ctx *event.Context, newPos mgl64.Vec3, newYaw, newPitch float64) {
-	s.handleEvent(eventMove, func(h Handler) {
+	s.handleEvent(eventMove, ctx, nil, func(h Handler) {
 		h.(eventMoveHandler).HandleMove(ctx, newPos, newYaw, newPitch)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleMove(d, ctx, newPos, newYaw, newPitch)
 	})
 }
 
 func (s *Session) HandleJump() {
-	s.handleEvent(eventJump, func(h Handler) {
+	s.handleEvent(eventJump, nil, nil, func(h Handler) {
 		h.(eventJumpHandler).HandleJump()
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleJump(d)
 	})
 }
 
 func (s *Session) HandleTeleport(ctx *event.Context, pos mgl64.Vec3) {
-	s.handleEvent(eventTeleport, func(h Handler) {
+	s.handleEvent(eventTeleport, ctx, nil, func(h Handler) {
 		h.(eventTeleportHandler).HandleTeleport(ctx, pos)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleTeleport(d, ctx, pos)
 	})
 }
 
 func (s *Session) HandleChangeWorld(before, after *world.World) {
-	s.handleEvent(eventChangeWorld, func(h Handler) {
+	s.handleEvent(eventChangeWorld, nil, nil, func(h Handler) {
 		h.(eventChangeWorldHandler).HandleChangeWorld(before, after)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleChangeWorld(d, before, after)
 	})
 }
 
 func (s *Session) HandleToggleSprint(ctx *event.Context, after bool) {
-	s.handleEvent(eventToggleSprint, func(h Handler) {
+	s.handleEvent(eventToggleSprint, ctx, nil, func(h Handler) {
 		h.(eventToggleSprintHandler).HandleToggleSprint(ctx, after)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleToggleSprint(d, ctx, after)
 	})
 }
 
 func (s *Session) HandleToggleSneak(ctx *event.Context, after bool) {
-	s.handleEvent(eventToggleSneak, func(h Handler) {
+	s.handleEvent(eventToggleSneak, ctx, nil, func(h Handler) {
 		h.(eventToggleSneakHandler).HandleToggleSneak(ctx, after)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleToggleSneak(d, ctx, after)
 	})
 }
 
 func (s *Session) HandleChat(ctx *event.Context, message *string) {
-	s.handleEvent(eventChat, func(h Handler) {
+	s.handleEvent(eventChat, ctx, nil, func(h Handler) {
 		h.(eventChatHandler).HandleChat(ctx, message)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleChat(d, ctx, message)
 	})
 }
 
 func (s *Session) HandleFoodLoss(ctx *event.Context, from int, to *int) {
-	s.handleEvent(eventFoodLoss, func(h Handler) {
+	s.handleEvent(eventFoodLoss, ctx, nil, func(h Handler) {
 		h.(eventFoodLossHandler).HandleFoodLoss(ctx, from, to)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleFoodLoss(d, ctx, from, to)
 	})
 }
 
 func (s *Session) HandleHeal(ctx *event.Context, health *float64, src world.HealingSource) {
-	s.handleEvent(eventHeal, func(h Handler) {
+	s.handleEvent(eventHeal, ctx, nil, func(h Handler) {
 		h.(eventHealHandler).HandleHeal(ctx, health, src)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleHeal(d, ctx, health, src)
 	})
 }
 
 func (s *Session) HandleHurt(ctx *event.Context, damage *float64, attackImmunity *time.Duration, src world.DamageSource) {
-	s.handleEvent(eventHurt, func(h Handler) {
+	s.handleEvent(eventHurt, ctx, nil, func(h Handler) {
 		h.(eventHurtHandler).HandleHurt(ctx, damage, attackImmunity, src)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleHurt(d, ctx, damage, attackImmunity, src)
 	})
 }
 
 func (s *Session) HandleDeath(src world.DamageSource, keepInv *bool) {
-	s.handleEvent(eventDeath, func(h Handler) {
+	s.handleEvent(eventDeath, nil, nil, func(h Handler) {
 		h.(eventDeathHandler).HandleDeath(src, keepInv)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleDeath(d, src, keepInv)
 	})
 }
 
 func (s *Session) HandleRespawn(pos *mgl64.Vec3, w **world.World) {
-	s.handleEvent(eventRespawn, func(h Handler) {
+	s.handleEvent(eventRespawn, nil, nil, func(h Handler) {
 		h.(eventRespawnHandler).HandleRespawn(pos, w)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleRespawn(d, pos, w)
 	})
 }
 
 func (s *Session) HandleSkinChange(ctx *event.Context, skin *skin.Skin) {
-	s.handleEvent(eventSkinChange, func(h Handler) {
+	s.handleEvent(eventSkinChange, ctx, nil, func(h Handler) {
 		h.(eventSkinChangeHandler).HandleSkinChange(ctx, skin)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleSkinChange(d, ctx, skin)
 	})
 }
 
 func (s *Session) HandleStartBreak(ctx *event.Context, pos cube.Pos) {
-	s.handleEvent(eventStartBreak, func(h Handler) {
+	s.handleEvent(eventStartBreak, ctx, nil, func(h Handler) {
 		h.(eventStartBreakHandler).HandleStartBreak(ctx, pos)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleStartBreak(d, ctx, pos)
 	})
 }
 
 func (s *Session) HandleBlockBreak(ctx *event.Context, pos cube.Pos, drops *[]item.Stack, xp *int) {
-	s.handleEvent(eventBlockBreak, func(h Handler) {
+	s.handleEvent(eventBlockBreak, ctx, nil, func(h Handler) {
 		h.(eventBlockBreakHandler).HandleBlockBreak(ctx, pos, drops, xp)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleBlockBreak(d, ctx, pos, drops, xp)
 	})
 }
 
 func (s *Session) HandleBlockPlace(ctx *event.Context, pos cube.Pos, b world.Block) {
-	s.handleEvent(eventBlockPlace, func(h Handler) {
+	s.handleEvent(eventBlockPlace, ctx, nil, func(h Handler) {
 		h.(eventBlockPlaceHandler).HandleBlockPlace(ctx, pos, b)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleBlockPlace(d, ctx, pos, b)
 	})
 }
 
 func (s *Session) HandleBlockPick(ctx *event.Context, pos cube.Pos, b world.Block) {
-	s.handleEvent(eventBlockPick, func(h Handler) {
+	s.handleEvent(eventBlockPick, ctx, nil, func(h Handler) {
 		h.(eventBlockPickHandler).HandleBlockPick(ctx, pos, b)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleBlockPick(d, ctx, pos, b)
 	})
 }
 
 func (s *Session) HandleItemUse(ctx *event.Context) {
-	s.handleEvent(eventItemUse, func(h Handler) {
+	s.handleEvent(eventItemUse, ctx, nil, func(h Handler) {
 		h.(eventItemUseHandler).HandleItemUse(ctx)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleItemUse(d, ctx)
 	})
 }
 
 func (s *Session) HandleItemUseOnBlock(ctx *event.Context, pos cube.Pos, face cube.Face, clickPos mgl64.Vec3) {
-	s.handleEvent(eventItemUseOnBlock, func(h Handler) {
+	s.handleEvent(eventItemUseOnBlock, ctx, nil, func(h Handler) {
 		h.(eventItemUseOnBlockHandler).HandleItemUseOnBlock(ctx, pos, face, clickPos)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleItemUseOnBlock(d, ctx, pos, face, clickPos)
 	})
 }
 
 func (s *Session) HandleItemUseOnEntity(ctx *event.Context, e world.Entity) {
-	s.handleEvent(eventItemUseOnEntity, func(h Handler) {
+	s.handleEvent(eventItemUseOnEntity, ctx, e, func(h Handler) {
 		h.(eventItemUseOnEntityHandler).HandleItemUseOnEntity(ctx, e)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleItemUseOnEntity(d, ctx, e)
 	})
 }
 
 func (s *Session) HandleItemConsume(ctx *event.Context, item item.Stack) {
-	s.handleEvent(eventItemConsume, func(h Handler) {
+	s.handleEvent(eventItemConsume, ctx, nil, func(h Handler) {
 		h.(eventItemConsumeHandler).HandleItemConsume(ctx, item)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleItemConsume(d, ctx, item)
 	})
 }
 
 func (s *Session) HandleAttackEntity(ctx *event.Context, e world.Entity, force, height *float64, critical *bool) {
-	s.handleEvent(eventAttackEntity, func(h Handler) {
+	s.handleEvent(eventAttackEntity, ctx, e, func(h Handler) {
 		h.(eventAttackEntityHandler).HandleAttackEntity(ctx, e, force, height, critical)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleAttackEntity(d, ctx, e, force, height, critical)
 	})
 }
 
 func (s *Session) HandleExperienceGain(ctx *event.Context, amount *int) {
-	s.handleEvent(eventExperienceGain, func(h Handler) {
+	s.handleEvent(eventExperienceGain, ctx, nil, func(h Handler) {
 		h.(eventExperienceGainHandler).HandleExperienceGain(ctx, amount)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleExperienceGain(d, ctx, amount)
 	})
 }
 
 func (s *Session) HandlePunchAir(ctx *event.Context) {
-	s.handleEvent(eventPunchAir, func(h Handler) {
+	s.handleEvent(eventPunchAir, ctx, nil, func(h Handler) {
 		h.(eventPunchAirHandler).HandlePunchAir(ctx)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandlePunchAir(d, ctx)
 	})
 }
 
 func (s *Session) HandleSignEdit(ctx *event.Context, frontSide bool, oldText, newText string) {
-	s.handleEvent(eventSignEdit, func(h Handler) {
+	s.handleEvent(eventSignEdit, ctx, nil, func(h Handler) {
 		h.(eventSignEditHandler).HandleSignEdit(ctx, frontSide, oldText, newText)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleSignEdit(d, ctx, frontSide, oldText, newText)
 	})
 }
 
 func (s *Session) HandleItemDamage(ctx *event.Context, i item.Stack, damage int) {
-	s.handleEvent(eventItemDamage, func(h Handler) {
+	s.handleEvent(eventItemDamage, ctx, nil, func(h Handler) {
 		h.(eventItemDamageHandler).HandleItemDamage(ctx, i, damage)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleItemDamage(d, ctx, i, damage)
 	})
 }
 
 func (s *Session) HandleItemPickup(ctx *event.Context, i *item.Stack) {
-	s.handleEvent(eventItemPickup, func(h Handler) {
+	s.handleEvent(eventItemPickup, ctx, nil, func(h Handler) {
 		h.(eventItemPickupHandler).HandleItemPickup(ctx, i)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleItemPickup(d, ctx, i)
 	})
 }
 
 func (s *Session) HandleItemDrop(ctx *event.Context, e world.Entity) {
-	s.handleEvent(eventItemDrop, func(h Handler) {
+	s.handleEvent(eventItemDrop, ctx, e, func(h Handler) {
 		h.(eventItemDropHandler).HandleItemDrop(ctx, e)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleItemDrop(d, ctx, e)
 	})
 }
 
 func (s *Session) HandleTransfer(ctx *event.Context, addr *net.UDPAddr) {
-	s.handleEvent(eventTransfer, func(h Handler) {
+	s.handleEvent(eventTransfer, ctx, nil, func(h Handler) {
 		h.(eventTransferHandler).HandleTransfer(ctx, addr)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleTransfer(d, ctx, addr)
 	})
 }
 
 func (s *Session) HandleCommandExecution(ctx *event.Context, command cmd.Command, args []string) {
-	s.handleEvent(eventCommandExecution, func(h Handler) {
+	s.handleEvent(eventCommandExecution, ctx, nil, func(h Handler) {
 		h.(eventCommandExecutionHandler).HandleCommandExecution(ctx, command, args)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleCommandExecution(d, ctx, command, args)
 	})
 }
 
 func (s *Session) HandleQuit() {
-	s.handleEvent(eventQuit, func(h Handler) {
+	s.handleEvent(eventQuit, nil, nil, func(h Handler) {
 		h.(eventQuitHandler).HandleQuit()
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleQuit(d)
 	})
 	s.doQuit()
 }
 
 func (s *Session) HandleLecternPageTurn(ctx *event.Context, pos cube.Pos, oldPage int, newPage *int) {
-	s.handleEvent(eventLecternPageTurn, func(h Handler) {
+	s.handleEvent(eventLecternPageTurn, ctx, nil, func(h Handler) {
 		h.(eventLecternPageTurnHandler).HandleLecternPageTurn(ctx, pos, oldPage, newPage)
+	}, func(g *GeneratedHandler, d *Dispatch) {
+		g.HandleLecternPageTurn(d, ctx, pos, oldPage, newPage)
 	})
 }
@@ -0,0 +1,86 @@
+package peex
+
+import (
+	"time"
+)
+
+// Expires represents a Component that keeps track of when it expires. When such a component is added to a Session with
+// an expiry time that is not zero, it is automatically removed at that time. Because the expiry is stored in the
+// component itself, it is persisted by providers along with the rest of the component: a component loaded with an
+// expiry time is removed at the same time it would have been otherwise, even after the player rejoined.
+type Expires interface {
+	Component
+	// Expiry returns the time at which the component should be removed. The component never expires if this is the zero
+	// time.
+	Expiry() time.Time
+	// SetExpiry is called by Session.InsertFor to set the time at which the component expires.
+	SetExpiry(t time.Time)
+}
+
+// InsertFor inserts the Component in the same way as InsertComponent, and removes it again once the duration has passed.
+// The component is removed through the normal path, so the Remove method is called and the component is saved if it has
+// a provider. The removal is cancelled if the component is removed or replaced before that, or if the player quits.
+// If the component implements Expires, its expiry is set to the time at which it will be removed before it is added, so
+// it replaces any expiry loaded by a provider and is already set when Adder.Add is called. If the duration is not more
+// than zero, the component is inserted without expiring.
+func (s *Session) InsertFor(c Component, d time.Duration) error {
+	cId := s.m.getComponentId(c)
+
+	defer s.lock()()
+	return s.insertComponent(cId, c, d)
+}
+
+/// Internal expiry logic
+/// ---------------------
+
+// expiry is a scheduled removal of a component.
+type expiry struct {
+	t *time.Timer
+}
+
+// scheduleRemoval removes the component with the ID from the session once the duration has passed, replacing any removal
+// that was scheduled for it before. The components lock must be held for writing.
+func (s *Session) scheduleRemoval(cId componentId, d time.Duration) {
+	s.cancelRemoval(cId)
+	if s.expiries == nil {
+		s.expiries = map[componentId]*expiry{}
+	}
+	e := &expiry{}
+	s.expiries[cId] = e
+	e.t = time.AfterFunc(d, func() {
+		s.expire(cId, e)
+	})
+}
+
+// scheduleExpiry schedules the removal of a component that implements Expires and has an expiry time. The components
+// lock must be held for writing.
+func (s *Session) scheduleExpiry(cId componentId, c Component) {
+	e, ok := c.(Expires)
+	if !ok || e.Expiry().IsZero() {
+		return
+	}
+	s.scheduleRemoval(cId, max(time.Until(e.Expiry()), 0))
+}
+
+// cancelRemoval cancels the scheduled removal of the component with the ID, if there is one. The components lock must be
+// held for writing.
+func (s *Session) cancelRemoval(cId componentId) {
+	if e, ok := s.expiries[cId]; ok {
+		e.t.Stop()
+		delete(s.expiries, cId)
+	}
+}
+
+// expire removes a component once its scheduled removal is due. Nothing happens if the removal was cancelled or replaced
+// in the meantime, which includes the player quitting.
+func (s *Session) expire(cId componentId, e *expiry) {
+	defer s.lock()()
+	if s.expiries[cId] != e {
+		return
+	}
+	delete(s.expiries, cId)
+
+	if _, err := s.removeComponent(cId, s.components[cId]); err != nil {
+		s.log.Error("error removing expired component", "component", s.m.componentName(cId), "err", err)
+	}
+}
@@ -0,0 +1,160 @@
+package peex_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andreashgk/peex"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/google/uuid"
+)
+
+// Buff is a component that expires, and records whether its expiry was set when it was added and how often it was
+// removed.
+type Buff struct {
+	Until       time.Time
+	ExpiryOnAdd bool
+	RemoveCalls *atomic.Int32
+}
+
+func (b *Buff) Expiry() time.Time     { return b.Until }
+func (b *Buff) SetExpiry(t time.Time) { b.Until = t }
+func (b *Buff) Add(*player.Player)    { b.ExpiryOnAdd = !b.Until.IsZero() }
+func (b *Buff) Remove(*player.Player) {
+	if b.RemoveCalls != nil {
+		b.RemoveCalls.Add(1)
+	}
+}
+
+// BuffProvider loads buffs with a fixed expiry, and stores the expiry of the last buff it saved.
+type BuffProvider struct {
+	Until time.Time
+	mu    *sync.Mutex
+	saved *time.Time
+}
+
+func (p BuffProvider) Load(_ uuid.UUID, b *Buff) error {
+	b.Until = p.Until
+	return nil
+}
+
+func (p BuffProvider) Save(_ uuid.UUID, b *Buff) error {
+	p.mu.Lock()
+	*p.saved = b.Until
+	p.mu.Unlock()
+	return nil
+}
+
+// eventually fails the test if the condition does not become true within a second.
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("condition did not become true in time")
+		}
+	}
+}
+
+func hasBuff(s *peex.Session) bool {
+	_, ok := s.Component(&Buff{})
+	return ok
+}
+
+func TestInsertForRemovesComponent(t *testing.T) {
+	m := peex.New(peex.Config{})
+	s := accept(t, m)
+	removed := &atomic.Int32{}
+
+	b := &Buff{RemoveCalls: removed}
+	if err := s.InsertFor(b, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if !b.ExpiryOnAdd {
+		t.Error("expiry was not set before the component was added")
+	}
+	eventually(t, func() bool { return !hasBuff(s) })
+	if removed.Load() != 1 {
+		t.Fatalf("Remove was called %v times, expected 1", removed.Load())
+	}
+}
+
+func TestInsertForCancelled(t *testing.T) {
+	tests := map[string]func(s *peex.Session) error{
+		"replace": func(s *peex.Session) error {
+			s.SetComponent(&Buff{})
+			return nil
+		},
+		"remove": func(s *peex.Session) error {
+			if _, err := s.RemoveComponent(&Buff{}); err != nil {
+				return err
+			}
+			return s.InsertComponent(&Buff{})
+		},
+	}
+	for name, f := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := peex.New(peex.Config{})
+			s := accept(t, m)
+			if err := s.InsertFor(&Buff{}, 20*time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+			if err := f(s); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(60 * time.Millisecond)
+			if !hasBuff(s) {
+				t.Fatal("component was removed after its removal was cancelled")
+			}
+		})
+	}
+}
+
+func TestInsertForCancelledOnQuit(t *testing.T) {
+	m := peex.New(peex.Config{})
+	s := accept(t, m)
+	removed := &atomic.Int32{}
+	if err := s.InsertFor(&Buff{RemoveCalls: removed}, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	s.HandleQuit()
+	time.Sleep(60 * time.Millisecond)
+	if removed.Load() != 1 {
+		t.Fatalf("Remove was called %v times, expected only once when quitting", removed.Load())
+	}
+}
+
+func TestExpiresPersisted(t *testing.T) {
+	newManager := func(until time.Time) (*peex.Manager, *sync.Mutex, *time.Time) {
+		mu, saved := &sync.Mutex{}, &time.Time{}
+		return peex.New(peex.Config{Providers: []peex.ComponentProvider{
+			peex.WrapProvider[Buff](BuffProvider{Until: until, mu: mu, saved: saved}),
+		}}), mu, saved
+	}
+
+	t.Run("loaded", func(t *testing.T) {
+		m, _, _ := newManager(time.Now().Add(20 * time.Millisecond))
+		s := accept(t, m)
+		if err := s.InsertComponent(&Buff{}); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, func() bool { return !hasBuff(s) })
+	})
+	t.Run("InsertFor replaces loaded", func(t *testing.T) {
+		m, mu, saved := newManager(time.Now().Add(time.Hour))
+		s := accept(t, m)
+		start := time.Now()
+		if err := s.InsertFor(&Buff{}, 20*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, func() bool { return !hasBuff(s) })
+
+		mu.Lock()
+		defer mu.Unlock()
+		if saved.Before(start) || saved.After(start.Add(time.Second)) {
+			t.Fatalf("component was saved with expiry %v, expected the expiry set by InsertFor", saved)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package peex
+
+import (
+	"context"
+	"errors"
+	"github.com/df-mc/dragonfly/server/event"
+	"github.com/df-mc/dragonfly/server/player"
+	"reflect"
+)
+
+// Observe makes the global handlers of the manager handle the events of a player that does not have a session, such as
+// a player that has not logged in yet. The player can still be accepted into a session using Accept later on, after
+// which its events are handled by the session instead. Global handlers receive a nil *Session for observed players.
+// An error is returned if the player has already been accepted into a session, as that session would stop receiving
+// its events otherwise.
+func (m *Manager) Observe(p *player.Player) error {
+	m.sessionMu.Lock()
+	defer m.sessionMu.Unlock()
+
+	if _, ok := m.sessions[p.UUID()]; ok {
+		return errors.New("trying to observe a player that already has a session")
+	}
+	s := &Session{
+		m:        m,
+		id:       p.UUID(),
+		log:      m.log.With("player.uuid", p.UUID().String(), "player.name", p.Name()),
+		detached: true,
+	}
+	s.p.Store(p)
+	p.Handle(s)
+	return nil
+}
+
+// Broadcast emits a custom event for every session in the manager, in the same way as Emit. The sessions are handled
+// one after another in the order of their UUIDs. The amount of sessions for which the event was cancelled is returned.
+// Broadcast must not be called while any session is locked.
+func (m *Manager) Broadcast(e any) (cancelled int) {
+	sessions := m.Sessions()
+	sortSessions(sessions)
+	for _, s := range sessions {
+		if Emit(s, e) {
+			cancelled++
+		}
+	}
+	return cancelled
+}
+
+/// Internal global handler logic
+/// -----------------------------
+
+// registerGlobal registers a global handler for every event it handles.
+func (m *Manager) registerGlobal(h Handler) {
+	t := reflect.TypeOf(h)
+	if _, ok := m.handlers.Load().ids[t]; ok {
+		panic("re-registering an existing handler type")
+	}
+	for _, info := range m.globalHandlers {
+		if info.typ == t {
+			panic("re-registering an existing handler type")
+		}
+	}
+
+	info := m.createHandlerInfo(h)
+	if len(info.components) > 0 || len(info.targets) > 0 {
+		panic("global handlers cannot have queries (" + info.name + ")")
+	}
+	m.globalHandlers = append(m.globalHandlers, info)
+	for id := range info.events {
+		m.globalEvents[id] = append(m.globalEvents[id], info)
+	}
+}
+
+// handleGlobal runs the global handlers of an event. Global handlers have no queries, so the session does not need to be
+// locked while they run.
+func (s *Session) handleGlobal(tctx context.Context, eventId eventId, ctx *event.Context, f func(h Handler), gen func(g *GeneratedHandler, d *Dispatch)) {
+	disabledGroups := s.disabledGroupBits()
+	for _, info := range s.m.globalEvents[eventId] {
+		if info.state.disabled.Load() || info.groups&disabledGroups != 0 {
+			continue
+		}
+		report := s.callHandler(tctx, eventId, info, nil, nil, f, gen)
+		if report != nil && s.m.handleErrors(s, eventId, info, report) && ctx != nil {
+			ctx.Cancel()
+		}
+	}
+}
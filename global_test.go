@@ -0,0 +1,47 @@
+package peex_test
+
+import (
+	"testing"
+
+	"github.com/andreashgk/peex"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/player/skin"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+func TestObserveAcceptedPlayer(t *testing.T) {
+	m := peex.New(peex.Config{Handlers: []peex.Handler{IncrementHandler{}}})
+	p := player.New("test", skin.Skin{}, mgl64.Vec3{})
+	s, err := m.Accept(p, &Counter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Observe(p); err == nil {
+		t.Fatal("expected observing an accepted player to fail")
+	}
+	// The events of the player must still be handled by its session.
+	p.Handler().HandleJump()
+	c, _ := s.Component(&Counter{})
+	if n := c.(*Counter).N; n != 1 {
+		t.Fatalf("counter is %v, expected 1", n)
+	}
+}
+
+func TestObserveThenAccept(t *testing.T) {
+	m := peex.New(peex.Config{Handlers: []peex.Handler{IncrementHandler{}}})
+	p := player.New("test", skin.Skin{}, mgl64.Vec3{})
+	if err := m.Observe(p); err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.Accept(p, &Counter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Handler().HandleJump()
+	c, _ := s.Component(&Counter{})
+	if n := c.(*Counter).N; n != 1 {
+		t.Fatalf("counter is %v, expected 1", n)
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/andreashgk/peex
 
-go 1.18
+go 1.23
 
 require (
 	github.com/df-mc/atomic v1.10.0
@@ -0,0 +1,121 @@
+package peex
+
+import (
+	"fmt"
+	"github.com/df-mc/atomic"
+	"reflect"
+	"slices"
+)
+
+// SetGroupEnabled enables or disables a handler group for every session. The handlers and systems in a disabled group
+// do not run, regardless of whether the group is enabled for the session itself. An error is returned if the group was
+// not specified in the Config.
+func (m *Manager) SetGroupEnabled(group string, enabled bool) error {
+	bit, err := m.groupBit(group)
+	if err != nil {
+		return err
+	}
+	setGroupBit(&m.disabledGroups, bit, !enabled)
+	return nil
+}
+
+// GroupEnabled returns whether a handler group is enabled globally. False is returned if the group was not specified
+// in the Config.
+func (m *Manager) GroupEnabled(group string) bool {
+	bit, err := m.groupBit(group)
+	return err == nil && m.disabledGroups.Load()&bit == 0
+}
+
+// DisableGroup disables a handler group for the session only, for example while an admin is vanished. The handlers and
+// systems in the group no longer run for the session until the group is enabled again using EnableGroup. An error is
+// returned if the group was not specified in the Config.
+func (s *Session) DisableGroup(group string) error {
+	bit, err := s.m.groupBit(group)
+	if err != nil {
+		return err
+	}
+	setGroupBit(&s.disabledGroups, bit, true)
+	return nil
+}
+
+// EnableGroup enables a handler group for the session again after it was disabled using DisableGroup. The handlers in
+// the group still do not run if the group is disabled globally. An error is returned if the group was not specified in
+// the Config.
+func (s *Session) EnableGroup(group string) error {
+	bit, err := s.m.groupBit(group)
+	if err != nil {
+		return err
+	}
+	setGroupBit(&s.disabledGroups, bit, false)
+	return nil
+}
+
+// GroupEnabled returns whether the handlers in a group run for the session, which is not the case if the group is
+// disabled globally or for the session. False is returned if the group was not specified in the Config.
+func (s *Session) GroupEnabled(group string) bool {
+	bit, err := s.m.groupBit(group)
+	return err == nil && s.disabledGroupBits()&bit == 0
+}
+
+/// Internal group logic
+/// --------------------
+
+// maxGroups is the maximum amount of handler groups, as the groups are stored as bits of a uint64.
+const maxGroups = 64
+
+// registerGroups assigns a bit to every group in the config, and stores which groups every handler type is in. Groups
+// are sorted by name, so that the bits do not depend on the order of the map. It panics if there are too many groups,
+// or if a group has no name or contains a nil handler.
+func (m *Manager) registerGroups(groups map[string][]Handler) {
+	if len(groups) > maxGroups {
+		panic(fmt.Errorf("cannot have more than %d handler groups", maxGroups))
+	}
+	names := make([]string, 0, len(groups))
+	for name, handlers := range groups {
+		if name == "" {
+			panic("handler groups must have a name")
+		}
+		if slices.Contains(handlers, nil) {
+			panic("handler group " + name + " contains a nil handler")
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for i, name := range names {
+		bit := uint64(1) << i
+		m.groupBits[name] = bit
+		for _, h := range groups[name] {
+			m.handlerGroups[reflect.TypeOf(h)] |= bit
+		}
+	}
+}
+
+// groupBit returns the bit of a handler group, or an error if the group does not exist.
+func (m *Manager) groupBit(group string) (uint64, error) {
+	bit, ok := m.groupBits[group]
+	if !ok {
+		return 0, fmt.Errorf("unknown handler group %q", group)
+	}
+	return bit, nil
+}
+
+// disabledGroupBits returns the bits of the groups that are disabled for the session, either globally or for the session
+// itself.
+func (s *Session) disabledGroupBits() uint64 {
+	return s.m.disabledGroups.Load() | s.disabledGroups.Load()
+}
+
+// setGroupBit sets or clears the bit of a group in a set of disabled groups.
+func setGroupBit(disabled *atomic.Uint64, bit uint64, set bool) {
+	for {
+		old := disabled.Load()
+		n := old &^ bit
+		if set {
+			n = old | bit
+		}
+		if disabled.CAS(old, n) {
+			return
+		}
+	}
+}
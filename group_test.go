@@ -0,0 +1,111 @@
+package peex_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/andreashgk/peex"
+)
+
+// mustGroup fails the test if enabling or disabling a group returned an error.
+func mustGroup(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGroupLimit(t *testing.T) {
+	groups := func(n int) map[string][]peex.Handler {
+		g := map[string][]peex.Handler{}
+		for i := 0; i < n; i++ {
+			g["group"+strconv.Itoa(i)] = nil
+		}
+		return g
+	}
+
+	m := peex.New(peex.Config{Groups: groups(64)})
+	mustGroup(t, m.SetGroupEnabled("group63", false))
+	if m.GroupEnabled("group63") || !m.GroupEnabled("group0") {
+		t.Fatal("disabling the last group affected the wrong groups")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("creating a manager with 65 groups did not panic")
+		}
+	}()
+	peex.New(peex.Config{Groups: groups(65)})
+}
+
+func TestInvalidGroupsPanic(t *testing.T) {
+	tests := map[string]map[string][]peex.Handler{
+		"empty name":  {"": {FirstHandler{}}},
+		"nil handler": {"group": {nil}},
+	}
+	for name, groups := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("creating a manager with an invalid group did not panic")
+				}
+			}()
+			peex.New(peex.Config{Groups: groups})
+		})
+	}
+}
+
+func TestUnknownGroup(t *testing.T) {
+	m := peex.New(peex.Config{Groups: map[string][]peex.Handler{"known": nil}})
+	s := accept(t, m)
+
+	if m.SetGroupEnabled("unknown", false) == nil {
+		t.Error("disabling an unknown group globally did not return an error")
+	}
+	if s.DisableGroup("unknown") == nil {
+		t.Error("disabling an unknown group for a session did not return an error")
+	}
+	if s.EnableGroup("unknown") == nil {
+		t.Error("enabling an unknown group for a session did not return an error")
+	}
+	if m.GroupEnabled("unknown") || s.GroupEnabled("unknown") {
+		t.Error("unknown group is reported as enabled")
+	}
+}
+
+func TestHandlerGroups(t *testing.T) {
+	var order []string
+	m := peex.New(peex.Config{
+		Handlers: []peex.Handler{FirstHandler{Order: &order}},
+		Groups:   map[string][]peex.Handler{"first": {FirstHandler{}}, "late": {LateHandler{}}},
+	})
+	// Handlers registered after the manager was created are in the groups of their type as well.
+	m.RegisterHandler(LateHandler{Order: &order})
+	a, b := accept(t, m), accept(t, m)
+
+	jump := func(expected ...string) {
+		t.Helper()
+		order = nil
+		withTimeout(t, a.HandleJump)
+		withTimeout(t, b.HandleJump)
+		if len(order) != len(expected) {
+			t.Fatalf("handlers ran in order %v, expected %v", order, expected)
+		}
+		for i := range order {
+			if order[i] != expected[i] {
+				t.Fatalf("handlers ran in order %v, expected %v", order, expected)
+			}
+		}
+	}
+
+	jump("first", "late", "first", "late")
+	mustGroup(t, a.DisableGroup("late"))
+	if a.GroupEnabled("late") || !b.GroupEnabled("late") || !m.GroupEnabled("late") {
+		t.Fatal("disabling a group for a session affected other sessions or the manager")
+	}
+	jump("first", "first", "late")
+	mustGroup(t, m.SetGroupEnabled("first", false))
+	jump("late")
+	mustGroup(t, a.EnableGroup("late"))
+	mustGroup(t, m.SetGroupEnabled("first", true))
+	jump("first", "late", "first", "late")
+}
@@ -1,9 +1,18 @@
 package peex
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"github.com/df-mc/atomic"
+	"github.com/df-mc/dragonfly/server/event"
 	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+	"log/slog"
 	"reflect"
+	"runtime/debug"
+	"strings"
+	"time"
 )
 
 // Handler is a struct that handles player-related events. It can query for certain components contained in the player
@@ -18,17 +27,39 @@ type handlerId uint
 
 // handlerInfo contains data about a specific handler type.
 type handlerInfo struct {
-	h   Handler
-	typ reflect.Type
+	h    Handler
+	typ  reflect.Type
+	name string
 
 	components []componentQuery
+	targets    []componentQuery // queries on the session of the entity targeted by an event
 	events     map[eventId]struct{}
+	// mutable is true if the handler has a Mut query, in which case the sessions must be locked for writing.
+	mutable bool
+	// groups contains the bits of the handler groups the handler is in.
+	groups uint64
 
 	playerField  int
 	sessionField int
 	managerField int
+	errorsField  int
+	loggerField  int
 
 	copyFields []int // fields that need to be copied over to a new instance of the handler
+	resources  []resourceField
+
+	gen *GeneratedHandler // generated code for the handler, which is used instead of reflection if it is present
+
+	state *handlerState
+}
+
+// handlerState contains the runtime state of a handler that is shared between all sessions.
+type handlerState struct {
+	// panics is the amount of times the handler has panicked since it was last enabled.
+	panics   atomic.Int32
+	disabled atomic.Bool
+
+	stats handlerStats
 }
 
 type componentQuery struct {
@@ -50,10 +81,15 @@ func (m *Manager) createHandlerInfo(h Handler) handlerInfo {
 	info := handlerInfo{
 		h:            h,
 		typ:          reflect.TypeOf(h),
+		name:         reflect.TypeOf(h).String(),
 		events:       getHandlerEvents(h),
 		playerField:  -1,
 		sessionField: -1,
 		managerField: -1,
+		errorsField:  -1,
+		loggerField:  -1,
+		groups:       m.handlerGroups[reflect.TypeOf(h)],
+		state:        &handlerState{},
 	}
 	for i := 0; i < v.NumField(); i++ {
 		// Fields marked with a `ignore:""` tag will be ignored by the library.
@@ -63,14 +99,26 @@ func (m *Manager) createHandlerInfo(h Handler) handlerInfo {
 
 		// Ignore unexported fields
 		if !v.Field(i).CanInterface() {
-			if m.logger != nil {
-				m.logger.Debugf("warning: unexported handler fields cannot be copied by Peex")
-			}
+			m.log.Debug("unexported handler fields cannot be copied by Peex", "handler", info.name, "field", v.Type().Field(i).Name)
 			continue
 		}
 		switch x := v.Field(i).Interface().(type) {
+		case targetType:
+			inner := x.inner()
+			info.mutable = info.mutable || inner.mutable()
+			info.targets = append(info.targets, componentQuery{
+				id:       m.getComponentIdRefl(inner.getType()),
+				fieldNum: i,
+				optional: inner.optional(),
+			})
+		case resourceType:
+			info.resources = append(info.resources, resourceField{
+				fieldNum: i,
+				res:      m.mustResource(x.resourceType(), "handler "+info.name),
+			})
 		case queryType:
 			fieldType := x.getType()
+			info.mutable = info.mutable || x.mutable()
 
 			cId := m.getComponentIdRefl(fieldType)
 			info.components = append(info.components, componentQuery{
@@ -96,70 +144,312 @@ func (m *Manager) createHandlerInfo(h Handler) handlerInfo {
 				continue
 			}
 			info.managerField = i
+		case *slog.Logger:
+			// We don't need to pass the same logger multiple times
+			if info.loggerField != -1 {
+				continue
+			}
+			info.loggerField = i
+		case Errors:
+			// Errors are collected per handler, so only one field is needed.
+			if info.errorsField != -1 {
+				continue
+			}
+			info.errorsField = i
 		default:
 			info.copyFields = append(info.copyFields, i)
 			continue
 		}
 	}
 
+	for id := range getCustomEvents(info.typ) {
+		info.events[id] = struct{}{}
+	}
+
+	info.gen = m.generatedHandler(info)
 	return info
 }
 
-// handleEvent handles all shared logic for events, such as assigning query values.
-func (s *Session) handleEvent(eventId eventId, f func(h Handler)) {
-	s.componentsMu.RLock()
-	defer s.componentsMu.RUnlock()
-handlerLoop:
-	for _, id := range s.m.eventHandlers[eventId] {
-		info := s.m.handlers[id]
-
-		// Figure out which components to set in the queries
-		comps := make([]componentQuery, 0, len(info.components))
-		for _, compQuery := range info.components {
-			_, isPresent := s.components[compQuery.id]
-			if !isPresent && !compQuery.optional {
-				continue handlerLoop
-			} else if !isPresent && compQuery.optional {
-				continue
-			}
+// handleEvent handles all shared logic for events, such as assigning query values. The context is nil for events that
+// cannot be cancelled, and the target is the entity involved in the event, which may also be nil.
+// Handlers with generated code are called using gen, and every other handler using f. Gen is nil for custom events, which
+// are always handled using f.
+func (s *Session) handleEvent(eventId eventId, ctx *event.Context, target world.Entity, f func(h Handler), gen func(g *GeneratedHandler, d *Dispatch)) {
+	// Deferred functions run in reverse order, so this runs after the locks acquired below have been released.
+	defer s.removeOnEvent(eventId)
+	if s.m.metrics != nil {
+		start := time.Now()
+		defer func() {
+			s.m.metrics.ObserveEvent(eventName(eventId), time.Since(start))
+		}()
+	}
+	tctx := context.Background()
+	if s.m.tracing() {
+		var span Span
+		tctx, span = s.m.tracer.Start(tctx, "peex.event",
+			Attribute{Key: "player.uuid", Value: s.id.String()},
+			Attribute{Key: "event", Value: eventName(eventId)},
+		)
+		defer span.End(nil)
+	}
+	s.handleGlobal(tctx, eventId, ctx, f, gen)
+	if s.detached {
+		// Only global handlers handle the events of players without a session.
+		return
+	}
 
-			comps = append(comps, compQuery)
+	ts := s.m.targetSession(target)
+	handlers := s.m.handlers.Load()
+	disabledGroups := s.disabledGroupBits()
+	for _, id := range handlers.events[eventId] {
+		info := handlers.handlers[id]
+		if info.state.disabled.Load() || info.groups&disabledGroups != 0 {
+			continue
 		}
+		s.dispatchHandler(tctx, eventId, ctx, info, ts, f, gen)
+	}
+}
+
+// dispatchHandler runs the event on a handler if the session matches its queries, after which the errors it reported
+// are handled. The error handler is only called once the sessions are unlocked again, so that it can freely change
+// their components.
+func (s *Session) dispatchHandler(tctx context.Context, eventId eventId, ctx *event.Context, info handlerInfo, ts *Session, f func(h Handler), gen func(g *GeneratedHandler, d *Dispatch)) {
+	report := s.lockAndCallHandler(tctx, eventId, ctx, info, ts, f, gen)
+	if report != nil && s.m.handleErrors(s, eventId, info, report) && ctx != nil {
+		ctx.Cancel()
+	}
+}
 
-		actualType := reflect.New(info.typ).Elem()
-		structType := actualType
-		if actualType.Kind() == reflect.Pointer {
-			val := reflect.New(info.typ.Elem())
-			actualType.Set(val.Elem().Addr())
+// lockAndCallHandler runs the event on a handler if the session matches its queries, and returns the errors reported by
+// the handler. The session is only locked while the handler runs, and only locked for writing if the handler has a Mut
+// query. The session of the target is only locked, and only passed to the handler, if the handler has Target fields.
+func (s *Session) lockAndCallHandler(tctx context.Context, eventId eventId, ctx *event.Context, info handlerInfo, ts *Session, f func(h Handler), gen func(g *GeneratedHandler, d *Dispatch)) *errorReport {
+	if len(info.targets) == 0 {
+		ts = nil
+	}
+	if ts != nil && ts != s {
+		unlock, _ := lockSessions([]*Session{s, ts}, !info.mutable)
+		defer unlock()
+	} else {
+		s.acquire(info.mutable)
+		defer s.release(info.mutable)
+	}
 
-			structType = actualType.Elem()
+	comps, ok := s.matchHandler(info, ts)
+	if !ok {
+		if s.m.metrics != nil {
+			s.m.metrics.ObserveHandler(info.name, eventName(eventId), false, 0)
 		}
+		return nil
+	}
+	return s.callHandler(tctx, eventId, info, comps, ts, f, gen)
+}
 
-		for _, compQuery := range comps {
-			field := structType.Field(compQuery.fieldNum)
-			query := field.Interface().(queryType)
+// callHandler creates an instance of a handler with the queries that matched and runs the event on it, after which the
+// pending writes are applied. The errors reported by the handler are returned, so that they can be handled once the
+// sessions are unlocked.
+func (s *Session) callHandler(tctx context.Context, eventId eventId, info handlerInfo, comps []componentQuery, ts *Session, f func(h Handler), gen func(g *GeneratedHandler, d *Dispatch)) *errorReport {
+	d := &Dispatch{s: s, ts: ts, info: &info}
+	if info.gen != nil && gen != nil {
+		// The handler has generated code, so it can be created and called without any reflection.
+		s.runHandler(tctx, eventId, info, func() {
+			gen(info.gen, d)
+		})
+	} else {
+		h := s.buildHandler(d, comps)
+		s.runHandler(tctx, eventId, info, func() {
+			f(h)
+		})
+	}
+	// Only handlers with a Mut query can have pending writes, in which case the sessions are locked for writing.
+	applyWrites(d.writes)
+	return d.report
+}
 
-			field.Set(reflect.ValueOf(query.set(s.components[compQuery.id].(Component))))
-		}
+// buildHandler creates a new instance of a handler using reflection, setting all the query values and injected fields.
+// The error report and the pending writes of the handler are stored in the dispatch.
+func (s *Session) buildHandler(d *Dispatch, comps []componentQuery) Handler {
+	info, ts := *d.info, d.ts
+	actualType := reflect.New(info.typ).Elem()
+	structType := actualType
+	if actualType.Kind() == reflect.Pointer {
+		val := reflect.New(info.typ.Elem())
+		actualType.Set(val.Elem().Addr())
+
+		structType = actualType.Elem()
+	}
+
+	for _, compQuery := range comps {
+		field := structType.Field(compQuery.fieldNum)
+		query := field.Interface().(queryType)
 
-		if info.playerField != -1 {
-			structType.Field(info.playerField).Set(reflect.ValueOf(s.Player()))
+		cId, c, _ := s.queryComponent(compQuery.id)
+		q := query.set(c)
+		d.writes = trackWrite(d.writes, s, cId, q)
+		field.Set(reflect.ValueOf(q))
+	}
+	for _, targetQuery := range info.targets {
+		field := structType.Field(targetQuery.fieldNum)
+		t := field.Interface().(targetType)
+
+		query := t.inner()
+		if cId, c, ok := ts.queryComponent(targetQuery.id); ok {
+			query = query.set(c)
+			d.writes = trackWrite(d.writes, ts, cId, query)
 		}
-		if info.sessionField != -1 {
-			structType.Field(info.sessionField).Set(reflect.ValueOf(s))
+		field.Set(reflect.ValueOf(t.setTarget(ts, query)))
+	}
+
+	for _, rf := range info.resources {
+		field := structType.Field(rf.fieldNum)
+		r := field.Interface().(resourceType)
+		field.Set(reflect.ValueOf(r.setResource(rf.res.v.Load())))
+	}
+
+	if info.playerField != -1 {
+		structType.Field(info.playerField).Set(reflect.ValueOf(s.Player()))
+	}
+	if info.sessionField != -1 {
+		structType.Field(info.sessionField).Set(reflect.ValueOf(d.Session()))
+	}
+	if info.managerField != -1 {
+		structType.Field(info.managerField).Set(reflect.ValueOf(s.m))
+	}
+	if info.loggerField != -1 {
+		structType.Field(info.loggerField).Set(reflect.ValueOf(d.Logger()))
+	}
+	if info.errorsField != -1 {
+		structType.Field(info.errorsField).Set(reflect.ValueOf(d.Errors()))
+	}
+
+	// Copy the other fields if there are any
+	if len(info.copyFields) > 0 {
+		hVal := reflect.Indirect(reflect.ValueOf(info.h))
+		for _, fieldNum := range info.copyFields {
+			structType.Field(fieldNum).Set(hVal.Field(fieldNum))
 		}
-		if info.managerField != -1 {
-			structType.Field(info.managerField).Set(reflect.ValueOf(s.m))
+	}
+
+	return actualType.Interface().(Handler)
+}
+
+// matchHandler checks whether the session, and the session of the target if there is one, have all the components
+// required by the handler. The queries for the components that are present are returned.
+func (s *Session) matchHandler(info handlerInfo, ts *Session) ([]componentQuery, bool) {
+	comps := make([]componentQuery, 0, len(info.components))
+	for _, compQuery := range info.components {
+		_, _, isPresent := s.queryComponent(compQuery.id)
+		if !isPresent && !compQuery.optional {
+			return nil, false
+		} else if !isPresent && compQuery.optional {
+			continue
 		}
 
-		// Copy the other fields if there are any
-		if len(info.copyFields) > 0 {
-			hVal := reflect.ValueOf(info.h)
-			for _, fieldNum := range info.copyFields {
-				structType.Field(fieldNum).Set(hVal.Elem().Field(fieldNum))
+		comps = append(comps, compQuery)
+	}
+	// Target queries can only match if the event actually has a player with a session as target.
+	if len(info.targets) > 0 {
+		if ts == nil {
+			return nil, false
+		}
+		for _, targetQuery := range info.targets {
+			if _, _, isPresent := ts.queryComponent(targetQuery.id); !isPresent && !targetQuery.optional {
+				return nil, false
 			}
 		}
+	}
+	return comps, true
+}
+
+// runHandler runs the function that handles the event on a handler, reporting it to the metrics, tracer and watchdog if
+// they are enabled. The context contains the span of the event as a whole.
+func (s *Session) runHandler(tctx context.Context, eventId eventId, info handlerInfo, f func()) {
+	if s.m.metrics == nil && !s.m.tracing() && s.m.slowThreshold <= 0 {
+		s.invokeHandler(eventId, info, f)
+		return
+	}
+	_, span := s.m.tracer.Start(tctx, "peex.handler",
+		Attribute{Key: "player.uuid", Value: s.id.String()},
+		Attribute{Key: "event", Value: eventName(eventId)},
+		Attribute{Key: "handler", Value: info.name},
+	)
+	var done func(d time.Duration)
+	if s.m.slowThreshold > 0 {
+		done = s.watchHandler(eventId, info)
+	}
+	start := time.Now()
+	r := s.invokeHandler(eventId, info, f)
+	d := time.Since(start)
+	if done != nil {
+		done(d)
+	}
+	if s.m.metrics != nil {
+		s.m.metrics.ObserveHandler(info.name, eventName(eventId), true, d)
+	}
+	if r != nil {
+		span.End(fmt.Errorf("handler panicked: %v", r))
+		return
+	}
+	span.End(nil)
+}
+
+// invokeHandler calls the function that runs the event on a handler. If panics should be recovered, a panic in this
+// function is logged and counted towards disabling the handler. The recovered value is returned in this case.
+func (s *Session) invokeHandler(eventId eventId, info handlerInfo, f func()) (r any) {
+	if !s.m.recoverPanics {
+		f()
+		return nil
+	}
+	defer func() {
+		if r = recover(); r != nil {
+			s.m.handlerPanicked(s, eventId, info, r, debug.Stack())
+		}
+	}()
+	f()
+	return nil
+}
+
+// handlerPanicked logs a panic that was recovered from a handler, and disables the handler if it panicked too often.
+func (m *Manager) handlerPanicked(s *Session, eventId eventId, info handlerInfo, r any, stack []byte) {
+	s.log.Error("handler panicked", "handler", info.name, "event", eventName(eventId), "panic", fmt.Sprint(r), "stack", string(stack))
 
-		f(actualType.Interface().(Handler))
+	panics := info.state.panics.Inc()
+	if m.maxHandlerPanics > 0 && int(panics) >= m.maxHandlerPanics && !info.state.disabled.Swap(true) {
+		m.log.Error("handler has been disabled after panicking too often", "handler", info.name, "panics", panics)
+	}
+}
+
+// eventNames maps every event to the name it has in handler methods, such as Move for HandleMove.
+var eventNames = func() map[eventId]string {
+	names := make(map[eventId]string, len(allEvents))
+	for name, id := range allEvents {
+		names[id] = strings.TrimPrefix(name, "event")
+	}
+	names[eventTick] = "Tick"
+	return names
+}()
+
+// eventName returns the name of an event as it is used in handler methods, such as Move for HandleMove.
+func eventName(id eventId) string {
+	if name, ok := eventNames[id]; ok {
+		return name
+	}
+	if name, ok := customEventName(id); ok {
+		return name
+	}
+	return "unknown event"
+}
+
+// targetSession returns the session of the entity targeted by an event, or nil if the entity is not a player with a
+// session.
+func (m *Manager) targetSession(target world.Entity) *Session {
+	p, ok := target.(*player.Player)
+	if !ok {
+		return nil
+	}
+	s, ok := m.SessionFromUUID(p.UUID())
+	if !ok {
+		return nil
 	}
+	return s
 }
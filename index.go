@@ -0,0 +1,116 @@
+package peex
+
+import (
+	"reflect"
+	"slices"
+)
+
+// SessionsWith returns every session that currently has a component of type T. This uses an index kept by the Manager,
+// so it does not need to look at the sessions that do not have the component. If T is an interface, every session with
+// a component that implements T is returned.
+func SessionsWith[T Component](m *Manager) []*Session {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Interface {
+		return m.sessionsImplementing(t)
+	}
+	cId, ok := m.lookupComponentId(t)
+	if !ok {
+		return nil
+	}
+
+	m.indexMu.RLock()
+	defer m.indexMu.RUnlock()
+	sessions := make([]*Session, 0, len(m.index[cId]))
+	for s := range m.index[cId] {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+/// Internal index logic
+/// --------------------
+
+// indexAdd marks the session as having the component with the ID in the index.
+func (m *Manager) indexAdd(cId componentId, s *Session) {
+	m.indexMu.Lock()
+	set, ok := m.index[cId]
+	if !ok {
+		set = map[*Session]struct{}{}
+		m.index[cId] = set
+	}
+	set[s] = struct{}{}
+	m.indexMu.Unlock()
+}
+
+// indexRemove removes the session from the index of the component with the ID.
+func (m *Manager) indexRemove(cId componentId, s *Session) {
+	m.indexMu.Lock()
+	delete(m.index[cId], s)
+	m.indexMu.Unlock()
+}
+
+// indexedSessions returns the sessions that have all the components with the IDs, using the smallest set of sessions in
+// the index. The returned sessions may still be missing some of the other components, so these still have to be checked.
+// If no IDs are provided, every session is returned. Interface types are not indexed, so their IDs are ignored. The
+// session lock must be held while calling this method.
+func (m *Manager) indexedSessions(cIds []componentId) []*Session {
+	cIds = slices.DeleteFunc(slices.Clone(cIds), m.isInterface)
+	if len(cIds) == 0 {
+		sessions := make([]*Session, 0, len(m.sessions))
+		for _, s := range m.sessions {
+			sessions = append(sessions, s)
+		}
+		return sessions
+	}
+
+	m.indexMu.RLock()
+	defer m.indexMu.RUnlock()
+	smallest := m.index[cIds[0]]
+	for _, cId := range cIds[1:] {
+		if set := m.index[cId]; len(set) < len(smallest) {
+			smallest = set
+		}
+	}
+	sessions := make([]*Session, 0, len(smallest))
+	for s := range smallest {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// sessionsImplementing returns every session with a component that implements the interface type.
+func (m *Manager) sessionsImplementing(t reflect.Type) []*Session {
+	var cIds []componentId
+	m.componentMu.RLock()
+	for id, ct := range m.componentTypes {
+		if ct.Kind() != reflect.Interface && ct.Implements(t) {
+			cIds = append(cIds, id)
+		}
+	}
+	m.componentMu.RUnlock()
+
+	m.indexMu.RLock()
+	defer m.indexMu.RUnlock()
+	found := map[*Session]struct{}{}
+	var sessions []*Session
+	for _, cId := range cIds {
+		for s := range m.index[cId] {
+			if _, ok := found[s]; !ok {
+				found[s] = struct{}{}
+				sessions = append(sessions, s)
+			}
+		}
+	}
+	return sessions
+}
+
+// requiredComponents returns the IDs of the components that must be present for a query function to run.
+func (info queryFuncInfo) requiredComponents() []componentId {
+	var cIds []componentId
+	for _, param := range info.params {
+		if !param.tx && param.res == nil && !param.optional {
+			cIds = append(cIds, param.cId)
+		}
+	}
+	return cIds
+}
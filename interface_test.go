@@ -0,0 +1,74 @@
+package peex_test
+
+import (
+	"testing"
+
+	"github.com/andreashgk/peex"
+)
+
+type Damageable interface {
+	Damage(amount float64)
+}
+
+type Knight struct{ Health float64 }
+
+func (k *Knight) Damage(amount float64) { k.Health -= amount }
+
+type Archer struct{ Health float64 }
+
+func (a *Archer) Damage(amount float64) { a.Health -= amount }
+
+func TestMutInterfaceSetSameType(t *testing.T) {
+	m := peex.New(peex.Config{})
+	s := accept(t, m, &Knight{Health: 20})
+
+	s.Query(func(d peex.Mut[Damageable]) {
+		d.Set(&Knight{Health: 10})
+	})
+	c, _ := s.Component(&Knight{})
+	if h := c.(*Knight).Health; h != 10 {
+		t.Fatalf("knight has %v health, expected 10", h)
+	}
+}
+
+func TestMutInterfaceDifferentTypePanics(t *testing.T) {
+	tests := map[string]func(d peex.Mut[Damageable]){
+		"Set": func(d peex.Mut[Damageable]) {
+			d.Set(&Archer{})
+		},
+		"Set nil": func(d peex.Mut[Damageable]) {
+			d.Set(nil)
+		},
+		"Update": func(d peex.Mut[Damageable]) {
+			d.Update(func(v *Damageable) {
+				*v = &Archer{}
+			})
+		},
+	}
+	for name, f := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := peex.New(peex.Config{})
+			s := accept(t, m, &Knight{Health: 20})
+
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Error("expected writing a value of another type to panic")
+					}
+				}()
+				s.Query(f)
+			}()
+
+			c, ok := s.Component(&Knight{})
+			if !ok {
+				t.Fatal("knight component was removed")
+			}
+			if k, ok := c.(*Knight); !ok || k.Health != 20 {
+				t.Fatalf("knight component was replaced by %#v", c)
+			}
+			if _, ok := s.Component(&Archer{}); ok {
+				t.Fatal("archer component was added")
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package peex
+
+import (
+	"cmp"
+	"iter"
+	"slices"
+)
+
+// Each returns an iterator over every session that has a component of type T, along with the component itself. Sessions
+// that lose the component or quit before they are reached are skipped.
+// Each session is locked for reading while the loop body runs, in the same way as for a query function without Mut
+// queries. The loop body may query any session and change other sessions, but must not modify the component or change
+// the current session, as that would wait for the lock forever. Sessions that need to be changed can be collected and
+// changed after the loop instead.
+//
+//	for s, stats := range peex.Each[*Stats](m) {
+//		// ...
+//	}
+func Each[T Component](m *Manager) iter.Seq2[*Session, T] {
+	return func(yield func(*Session, T) bool) {
+		cId := componentIdOf[T](m)
+		for _, s := range SessionsWith[T](m) {
+			if !yieldComponent(s, cId, yield) {
+				return
+			}
+		}
+	}
+}
+
+// Where returns an iterator over the sessions and values of the sequence for which the predicate returns true. The
+// predicate runs while the session of the value is locked for reading, like the loop body of Each.
+func Where[V any](seq iter.Seq2[*Session, V], pred func(v V) bool) iter.Seq2[*Session, V] {
+	return func(yield func(*Session, V) bool) {
+		for s, v := range seq {
+			if pred(v) && !yield(s, v) {
+				return
+			}
+		}
+	}
+}
+
+// SortBy returns an iterator over the sessions and values of the sequence, ordered from the lowest to the highest key.
+// The whole sequence is consumed before the first value is yielded. The key of every value is computed once while its
+// session is locked for reading, and each session is locked again for reading while the loop body runs for it.
+func SortBy[V any, K cmp.Ordered](seq iter.Seq2[*Session, V], key func(v V) K) iter.Seq2[*Session, V] {
+	return sortByKey(seq, key, func(a, b K) int {
+		return cmp.Compare(a, b)
+	})
+}
+
+// SortByDesc works the same as SortBy, but orders the values from the highest to the lowest key. This is useful for
+// leaderboards:
+//
+//	top := peex.Limit(peex.SortByDesc(peex.Each[*Stats](m), func(s *Stats) int { return s.Kills }), 10)
+func SortByDesc[V any, K cmp.Ordered](seq iter.Seq2[*Session, V], key func(v V) K) iter.Seq2[*Session, V] {
+	return sortByKey(seq, key, func(a, b K) int {
+		return cmp.Compare(b, a)
+	})
+}
+
+// SortFunc returns an iterator over the sessions and values of the sequence, ordered using the comparison function as
+// in slices.SortFunc. Values that compare equal keep the order of the sequence. The whole sequence is consumed before
+// the first value is yielded. The sessions of both values are locked for reading while they are compared, so SortBy
+// should be preferred if the values can be ordered by a key.
+func SortFunc[V any](seq iter.Seq2[*Session, V], compare func(a, b V) int) iter.Seq2[*Session, V] {
+	return func(yield func(*Session, V) bool) {
+		var entries []sessionValue[V, struct{}]
+		for s, v := range seq {
+			entries = append(entries, sessionValue[V, struct{}]{s: s, v: v})
+		}
+		slices.SortStableFunc(entries, func(a, b sessionValue[V, struct{}]) int {
+			unlock, _ := lockSessions(uniqueSessions(a.s, b.s), true)
+			defer unlock()
+			return compare(a.v, b.v)
+		})
+		yieldSorted(entries, yield)
+	}
+}
+
+// Limit returns an iterator over at most the first n sessions and values of the sequence.
+func Limit[V any](seq iter.Seq2[*Session, V], n int) iter.Seq2[*Session, V] {
+	return func(yield func(*Session, V) bool) {
+		if n <= 0 {
+			return
+		}
+		i := 0
+		for s, v := range seq {
+			if !yield(s, v) {
+				return
+			}
+			if i++; i >= n {
+				return
+			}
+		}
+	}
+}
+
+// First returns the first session and value of the sequence. False is returned if the sequence is empty. The session
+// is no longer locked once First returns, so the value must only be read through a query on the session afterwards.
+//
+//	s, team, ok := peex.First(peex.Where(peex.Each[*Team](m), func(t *Team) bool { return t.Name == "red" }))
+func First[V any](seq iter.Seq2[*Session, V]) (*Session, V, bool) {
+	for s, v := range seq {
+		return s, v, true
+	}
+	var zero V
+	return nil, zero, false
+}
+
+/// Internal iterator logic
+/// -----------------------
+
+// sessionValue is a session with a value from a sequence and the key it is sorted by.
+type sessionValue[V, K any] struct {
+	s   *Session
+	v   V
+	key K
+}
+
+// yieldComponent yields the session along with its component with the ID while the session is locked for reading.
+// Nothing is yielded if the session does not have the component. Returns false if the iteration should stop.
+func yieldComponent[T Component](s *Session, cId componentId, yield func(*Session, T) bool) bool {
+	s.acquire(false)
+	defer s.release(false)
+	_, c, ok := s.queryComponent(cId)
+	if !ok {
+		return true
+	}
+	return yield(s, c.(T))
+}
+
+// yieldLocked yields the session and value while the session is locked for reading. Nothing is yielded if the session
+// has quit. Returns false if the iteration should stop.
+func yieldLocked[V any](s *Session, v V, yield func(*Session, V) bool) bool {
+	s.acquire(false)
+	defer s.release(false)
+	if s.components == nil {
+		return true
+	}
+	return yield(s, v)
+}
+
+// yieldSorted yields the sorted entries in order, locking each session for reading while its value is yielded.
+func yieldSorted[V, K any](entries []sessionValue[V, K], yield func(*Session, V) bool) {
+	for _, e := range entries {
+		if !yieldLocked(e.s, e.v, yield) {
+			return
+		}
+	}
+}
+
+// sortByKey returns an iterator over the sessions and values of the sequence, ordered by their keys using the
+// comparison function. The keys are computed while the sequence yields the values, so while their sessions are locked.
+func sortByKey[V, K any](seq iter.Seq2[*Session, V], key func(v V) K, compare func(a, b K) int) iter.Seq2[*Session, V] {
+	return func(yield func(*Session, V) bool) {
+		var entries []sessionValue[V, K]
+		for s, v := range seq {
+			entries = append(entries, sessionValue[V, K]{s: s, v: v, key: key(v)})
+		}
+		slices.SortStableFunc(entries, func(a, b sessionValue[V, K]) int {
+			return compare(a.key, b.key)
+		})
+		yieldSorted(entries, yield)
+	}
+}
+
+// uniqueSessions returns the sessions passed, leaving out the second session if it is the same as the first.
+func uniqueSessions(a, b *Session) []*Session {
+	if a == b {
+		return []*Session{a}
+	}
+	return []*Session{a, b}
+}
@@ -0,0 +1,95 @@
+package peex_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/andreashgk/peex"
+)
+
+func TestEachWithMutHandler(t *testing.T) {
+	m := peex.New(peex.Config{Handlers: []peex.Handler{IncrementHandler{}}})
+	sessions := []*peex.Session{accept(t, m, &Counter{}), accept(t, m, &Counter{}), accept(t, m, &Counter{})}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for _, s := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					s.HandleJump()
+				}
+			}
+		}()
+	}
+
+	sum := 0
+	withTimeout(t, func() {
+		for i := 0; i < 100; i++ {
+			for _, c := range peex.Where(peex.Each[*Counter](m), func(c *Counter) bool { return c.N >= 0 }) {
+				sum += c.N
+			}
+			for _, c := range peex.SortBy(peex.Each[*Counter](m), func(c *Counter) int { return c.N }) {
+				sum += c.N
+			}
+			for _, c := range peex.SortFunc(peex.Each[*Counter](m), func(a, b *Counter) int { return a.N - b.N }) {
+				sum += c.N
+			}
+		}
+	})
+	close(stop)
+	wg.Wait()
+	if sum < 0 {
+		t.Fatalf("sum of counters is %v", sum)
+	}
+}
+
+func TestSortByDescAndLimit(t *testing.T) {
+	m := peex.New(peex.Config{})
+	for _, n := range []int{3, 1, 4, 1, 5} {
+		accept(t, m, &Counter{N: n})
+	}
+
+	var got []int
+	withTimeout(t, func() {
+		for _, c := range peex.Limit(peex.SortByDesc(peex.Each[*Counter](m), func(c *Counter) int { return c.N }), 3) {
+			got = append(got, c.N)
+		}
+	})
+	if len(got) != 3 || got[0] != 5 || got[1] != 4 || got[2] != 3 {
+		t.Fatalf("got %v, expected [5 4 3]", got)
+	}
+}
+
+func TestEachBodyQueriesCurrentSession(t *testing.T) {
+	m := peex.New(peex.Config{})
+	accept(t, m, &Counter{N: 1})
+
+	ran := 0
+	withTimeout(t, func() {
+		for s := range peex.Each[*Counter](m) {
+			s.Query(func(c peex.Query[*Counter]) {
+				ran += c.Load().N
+			})
+		}
+	})
+	if ran != 1 {
+		t.Fatalf("query in loop body ran %v times, expected 1", ran)
+	}
+}
+
+func TestFirstWithWhere(t *testing.T) {
+	m := peex.New(peex.Config{})
+	accept(t, m, &Team{Name: "blue"})
+	red := accept(t, m, &Team{Name: "red"})
+
+	s, team, ok := peex.First(peex.Where(peex.Each[*Team](m), func(t *Team) bool { return t.Name == "red" }))
+	if !ok || s != red || team.Name != "red" {
+		t.Fatalf("got %v, %v, %v, expected the red session", s, team, ok)
+	}
+}
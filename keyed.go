@@ -0,0 +1,266 @@
+package peex
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"iter"
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// Keyed is used to query every instance of a keyed component type, which are added to a Session using
+// Session.InsertKeyed. Unlike Query, a Keyed query always matches: if the session has no instances of the component,
+// the Keyed query is simply empty. A Keyed query holds the instances as they were when the handler or query function
+// started: instances that are added or removed afterwards are not reflected by it.
+type Keyed[c Component] struct {
+	vals keyedSet
+}
+
+// Get returns the instance of the component stored under the key, along with whether it exists.
+func (k Keyed[c]) Get(key string) (c, bool) {
+	v, ok := k.vals[key]
+	if !ok {
+		var zero c
+		return zero, false
+	}
+	return v.(c), true
+}
+
+// Len returns the amount of instances of the component.
+func (k Keyed[c]) Len() int {
+	return len(k.vals)
+}
+
+// All returns an iterator over every instance of the component along with its key, ordered by key.
+func (k Keyed[c]) All() iter.Seq2[string, c] {
+	return func(yield func(string, c) bool) {
+		keys := make([]string, 0, len(k.vals))
+		for key := range k.vals {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if !yield(key, k.vals[key].(c)) {
+				return
+			}
+		}
+	}
+}
+
+// InsertKeyed adds an instance of a keyed component to the session under the key. Unlike normal components, a session
+// can have any number of instances of a keyed component type, as long as they have different keys. An error is returned
+// if an instance with the same type and key is already present. The instance is loaded if a keyed provider for it has
+// been set in the config, and the Add method is called if it implements Adder.
+func (s *Session) InsertKeyed(key string, c Component) error {
+	cId := s.m.keyedComponentId(reflect.TypeOf(c))
+
+	defer s.lock()()
+
+	set, _ := s.components[cId].(keyedSet)
+	if _, ok := set[key]; ok {
+		return fmt.Errorf("session already has a keyed component of this type with key %q", key)
+	}
+	if p, ok := s.m.keyedProvs[cId]; ok {
+		err := s.m.observeProvider("load", cId, s.id, func() error {
+			return p.loadKeyed(s.id, key, c)
+		})
+		if err != nil {
+			return fmt.Errorf("error while loading keyed component: %w", err)
+		}
+	}
+	s.addKeyed(cId, key, c)
+	return nil
+}
+
+// SetKeyed sets the instance of a keyed component stored under the key, regardless of whether it was present before.
+// The Remove method is called on the previous instance and the Add method on the new one, in the same way as
+// SetComponent.
+//
+// NOTE: does NOT load the component!
+func (s *Session) SetKeyed(key string, c Component) {
+	cId := s.m.keyedComponentId(reflect.TypeOf(c))
+
+	defer s.lock()()
+
+	set, _ := s.components[cId].(keyedSet)
+	if prev, ok := set[key]; ok {
+		if r, ok := prev.(Remover); ok {
+			r.Remove(s.Player())
+		}
+		set = maps.Clone(set)
+		set[key] = c
+		s.storeComponent(cId, set)
+		if a, ok := c.(Adder); ok {
+			a.Add(s.Player())
+		}
+		return
+	}
+	s.addKeyed(cId, key, c)
+}
+
+// RemoveKeyed removes the instance of a keyed component with the same type as the argument stored under the key, and
+// returns it. The instance is saved if a keyed provider for it has been set in the config.
+func (s *Session) RemoveKeyed(key string, c Component) (Component, error) {
+	cId, ok := s.m.lookupComponentId(keyedType(reflect.TypeOf(c)))
+	if !ok {
+		return nil, errors.New("trying to remove unknown keyed component")
+	}
+
+	defer s.lock()()
+	return s.removeKeyed(cId, key)
+}
+
+// GenericKeyedProvider represents a struct that can load & save the instances of a keyed component. Every instance is
+// loaded and saved separately, using its key. Like with GenericProvider, the component type must be a pointer.
+type GenericKeyedProvider[c Component] interface {
+	// Load loads & writes data stored under the UUID and key to the pointer to the component c.
+	Load(id uuid.UUID, key string, comp *c) error
+	// Save writes the instance of the component stored under the key to storage.
+	Save(id uuid.UUID, key string, comp *c) error
+}
+
+// KeyedProviderWrapper is a wrapper around a GenericKeyedProvider, which works the same way as ProviderWrapper.
+type KeyedProviderWrapper[c Component] struct {
+	p GenericKeyedProvider[c]
+}
+
+// WrapKeyedProvider creates a new wrapper around a keyed provider of the desired type.
+func WrapKeyedProvider[c Component](p GenericKeyedProvider[c]) KeyedProviderWrapper[c] {
+	if p == nil {
+		panic("cannot provide nil as a keyed provider")
+	}
+	return KeyedProviderWrapper[c]{
+		p: p,
+	}
+}
+
+/// Internal keyed component logic
+/// ------------------------------
+
+// keyedSet stores every instance of a keyed component type in a session by their key. It is stored in the components
+// of the session under the ID of the keyed type of the component, so that keyed components can be queried, indexed
+// and locked in the same way as normal components. A set is never modified once it is stored in a session: it is
+// replaced by a modified copy instead, so that Keyed queries can keep using it after the session is unlocked.
+type keyedSet map[string]Component
+
+var stringType = reflect.TypeOf("")
+
+// keyedType returns the type under which the instances of a keyed component type are stored. It is a map type, so that
+// it can never be the type of the component itself.
+func keyedType(t reflect.Type) reflect.Type {
+	return reflect.MapOf(stringType, t)
+}
+
+// keyedComponentId returns the ID under which the instances of a keyed component type are stored.
+func (m *Manager) keyedComponentId(t reflect.Type) componentId {
+	return m.getComponentIdRefl(keyedType(t))
+}
+
+// keyedName returns the name of the component type of a keyed component ID.
+func (m *Manager) keyedName(cId componentId) string {
+	return m.componentType(cId).Elem().String()
+}
+
+// addKeyed adds an instance of a keyed component to the session. The components lock must be held for writing.
+func (s *Session) addKeyed(cId componentId, key string, c Component) {
+	set, ok := s.components[cId].(keyedSet)
+	set = maps.Clone(set)
+	if set == nil {
+		set = keyedSet{}
+	}
+	set[key] = c
+	s.storeComponent(cId, set)
+	if !ok {
+		s.componentsChanged()
+		s.m.indexAdd(cId, s)
+	}
+	if a, ok := c.(Adder); ok {
+		a.Add(s.Player())
+	}
+	if s.m.metrics != nil {
+		s.m.metrics.AddComponents(s.m.keyedName(cId), 1)
+	}
+}
+
+// removeKeyed removes an instance of a keyed component from the session. The components lock must be held for writing.
+func (s *Session) removeKeyed(cId componentId, key string) (Component, error) {
+	set, _ := s.components[cId].(keyedSet)
+	c, ok := set[key]
+	if !ok {
+		return nil, errors.New("trying to remove a keyed component not present in the session")
+	}
+	if r, ok := c.(Remover); ok {
+		r.Remove(s.Player())
+	}
+	if p, ok := s.m.keyedProvs[cId]; ok {
+		if err := s.m.saveKeyed(p, cId, s.id, key, c); err != nil {
+			return nil, fmt.Errorf("error while saving keyed component: %w", err)
+		}
+	}
+	set = maps.Clone(set)
+	delete(set, key)
+	if len(set) > 0 {
+		s.storeComponent(cId, set)
+	} else {
+		s.deleteComponent(cId)
+		s.componentsChanged()
+		s.m.indexRemove(cId, s)
+	}
+	if s.m.metrics != nil {
+		s.m.metrics.AddComponents(s.m.keyedName(cId), -1)
+	}
+	return c, nil
+}
+
+// saveKeyed saves an instance of a keyed component using its provider.
+func (m *Manager) saveKeyed(p KeyedComponentProvider, cId componentId, id uuid.UUID, key string, c Component) error {
+	return m.observeProvider("save", cId, id, func() error {
+		return p.saveKeyed(id, key, c)
+	})
+}
+
+func (k Keyed[c]) getType() reflect.Type {
+	return keyedType(reflect.TypeOf((*c)(nil)).Elem())
+}
+
+func (k Keyed[c]) optional() bool {
+	return true
+}
+
+func (k Keyed[c]) mutable() bool {
+	return false
+}
+
+func (k Keyed[c]) set(x any) queryType {
+	k.vals = x.(keyedSet)
+	return k
+}
+
+// KeyedComponentProvider is the interface representation of any type of KeyedProviderWrapper, allowing them to be passed
+// in the Config.
+type KeyedComponentProvider interface {
+	loadKeyed(id uuid.UUID, key string, x any) error
+	saveKeyed(id uuid.UUID, key string, x any) error
+	// componentId returns the keyed ID of the component type that the provider provides.
+	componentId(m *Manager) componentId
+	componentName() string
+}
+
+func (p KeyedProviderWrapper[c]) loadKeyed(id uuid.UUID, key string, x any) error {
+	return p.p.Load(id, key, x.(*c))
+}
+
+func (p KeyedProviderWrapper[c]) saveKeyed(id uuid.UUID, key string, x any) error {
+	return p.p.Save(id, key, x.(*c))
+}
+
+func (p KeyedProviderWrapper[c]) componentId(m *Manager) componentId {
+	return m.keyedComponentId(reflect.TypeOf(new(c)))
+}
+
+func (p KeyedProviderWrapper[c]) componentName() string {
+	t := reflect.TypeOf(new(c)).Elem()
+	return t.String()
+}
@@ -0,0 +1,198 @@
+package peex_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/andreashgk/peex"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/google/uuid"
+)
+
+// Cooldown is a keyed component that counts how often it was added and removed.
+type Cooldown struct {
+	Ticks   int
+	Added   int
+	Removed int
+}
+
+func (c *Cooldown) Add(*player.Player)    { c.Added++ }
+func (c *Cooldown) Remove(*player.Player) { c.Removed++ }
+
+// CooldownProvider loads cooldowns with the ticks stored for their key, and stores the ticks of saved cooldowns.
+type CooldownProvider struct {
+	mu    *sync.Mutex
+	ticks map[string]int
+}
+
+func (p CooldownProvider) Load(_ uuid.UUID, key string, c *Cooldown) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c.Ticks = p.ticks[key]
+	return nil
+}
+
+func (p CooldownProvider) Save(_ uuid.UUID, key string, c *Cooldown) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ticks[key] = c.Ticks
+	return nil
+}
+
+// CooldownHandler passes the Keyed query it receives to a function, which may keep using it after the handler returned.
+type CooldownHandler struct {
+	Cooldowns peex.Keyed[*Cooldown]
+	Seen      func(k peex.Keyed[*Cooldown])
+}
+
+func (h CooldownHandler) HandleJump() {
+	h.Seen(h.Cooldowns)
+}
+
+func TestInsertKeyed(t *testing.T) {
+	m := peex.New(peex.Config{})
+	s := accept(t, m)
+
+	fireball := &Cooldown{}
+	if err := s.InsertKeyed("fireball", fireball); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InsertKeyed("fireball", &Cooldown{}); err == nil {
+		t.Fatal("inserting a second instance with the same key did not fail")
+	}
+	if err := s.InsertKeyed("dash", &Cooldown{}); err != nil {
+		t.Fatal(err)
+	}
+	if fireball.Added != 1 {
+		t.Fatalf("Add was called %v times, expected 1", fireball.Added)
+	}
+	s.Query(func(k peex.Keyed[*Cooldown]) {
+		if k.Len() != 2 {
+			t.Errorf("query has %v instances, expected 2", k.Len())
+		}
+	})
+}
+
+func TestSetKeyed(t *testing.T) {
+	m := peex.New(peex.Config{})
+	s := accept(t, m)
+
+	prev, next := &Cooldown{}, &Cooldown{Ticks: 5}
+	s.SetKeyed("fireball", prev)
+	s.SetKeyed("fireball", next)
+	if prev.Removed != 1 || next.Added != 1 {
+		t.Fatalf("previous instance was removed %v times and new one added %v times, expected 1", prev.Removed, next.Added)
+	}
+	s.Query(func(k peex.Keyed[*Cooldown]) {
+		if c, ok := k.Get("fireball"); !ok || c != next || k.Len() != 1 {
+			t.Errorf("query found %v, %v with %v instances, expected only the new instance", c, ok, k.Len())
+		}
+	})
+}
+
+func TestRemoveKeyed(t *testing.T) {
+	m := peex.New(peex.Config{})
+	s := accept(t, m)
+
+	if _, err := s.RemoveKeyed("fireball", &Cooldown{}); err == nil {
+		t.Fatal("removing an unknown keyed component did not fail")
+	}
+	c := &Cooldown{}
+	if err := s.InsertKeyed("fireball", c); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := s.RemoveKeyed("fireball", &Cooldown{}); err != nil || removed != c {
+		t.Fatalf("RemoveKeyed returned %v, %v, expected the instance", removed, err)
+	}
+	if _, err := s.RemoveKeyed("fireball", &Cooldown{}); err == nil {
+		t.Fatal("removing an instance twice did not fail")
+	}
+	if c.Removed != 1 {
+		t.Fatalf("Remove was called %v times, expected 1", c.Removed)
+	}
+	s.Query(func(k peex.Keyed[*Cooldown]) {
+		if k.Len() != 0 {
+			t.Errorf("query has %v instances after removing the last one, expected none", k.Len())
+		}
+	})
+}
+
+func TestKeyedProvider(t *testing.T) {
+	p := CooldownProvider{mu: &sync.Mutex{}, ticks: map[string]int{"fireball": 3}}
+	m := peex.New(peex.Config{KeyedProviders: []peex.KeyedComponentProvider{peex.WrapKeyedProvider[Cooldown](p)}})
+	s := accept(t, m)
+
+	fireball, dash := &Cooldown{}, &Cooldown{}
+	if err := s.InsertKeyed("fireball", fireball); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InsertKeyed("dash", dash); err != nil {
+		t.Fatal(err)
+	}
+	if fireball.Ticks != 3 {
+		t.Fatalf("loaded %v ticks, expected 3", fireball.Ticks)
+	}
+
+	fireball.Ticks, dash.Ticks = 4, 7
+	if _, err := s.RemoveKeyed("fireball", &Cooldown{}); err != nil {
+		t.Fatal(err)
+	}
+	if p.ticks["fireball"] != 4 {
+		t.Fatalf("saved %v ticks on removal, expected 4", p.ticks["fireball"])
+	}
+	s.HandleQuit()
+	if p.ticks["dash"] != 7 || dash.Removed != 1 {
+		t.Fatalf("saved %v ticks and removed %v times on quit, expected 7 and 1", p.ticks["dash"], dash.Removed)
+	}
+}
+
+func TestKeyedQuery(t *testing.T) {
+	var last peex.Keyed[*Cooldown]
+	m := peex.New(peex.Config{Handlers: []peex.Handler{CooldownHandler{Seen: func(k peex.Keyed[*Cooldown]) { last = k }}}})
+	s := accept(t, m)
+
+	// A Keyed query matches even without instances.
+	withTimeout(t, s.HandleJump)
+	if last.Len() != 0 {
+		t.Fatalf("query has %v instances, expected none", last.Len())
+	}
+	for _, key := range []string{"b", "c", "a"} {
+		if err := s.InsertKeyed(key, &Cooldown{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	withTimeout(t, s.HandleJump)
+	var keys []string
+	for key := range last.All() {
+		keys = append(keys, key)
+	}
+	if len(keys) != 3 || keys[0] != "a" || keys[1] != "b" || keys[2] != "c" {
+		t.Fatalf("query has keys %v, expected [a b c]", keys)
+	}
+}
+
+func TestKeyedQueryIsNotChangedLater(t *testing.T) {
+	var last peex.Keyed[*Cooldown]
+	m := peex.New(peex.Config{Handlers: []peex.Handler{CooldownHandler{Seen: func(k peex.Keyed[*Cooldown]) { last = k }}}})
+	s := accept(t, m)
+	if err := s.InsertKeyed("fireball", &Cooldown{}); err != nil {
+		t.Fatal(err)
+	}
+	withTimeout(t, s.HandleJump)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.SetKeyed("fireball", &Cooldown{})
+		_ = s.InsertKeyed("dash", &Cooldown{})
+		_, _ = s.RemoveKeyed("fireball", &Cooldown{})
+	}()
+	for i := 0; i < 100; i++ {
+		if last.Len() != 1 {
+			t.Fatalf("query has %v instances, expected it not to change after the handler returned", last.Len())
+		}
+		for range last.All() {
+		}
+	}
+	<-done
+}
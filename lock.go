@@ -0,0 +1,135 @@
+package peex
+
+import (
+	"sync"
+	"time"
+)
+
+/// Internal locking logic
+/// ----------------------
+
+// sessionLock is the lock of the components of a session, which is held while handlers and query functions run. Unlike a
+// sync.RWMutex, it lets readers in while a writer is waiting as long as no writer holds the lock, so a handler or query
+// function that only reads the session can query it again without deadlocking. Writers may have to wait longer because
+// of this, but the lock of a single session is rarely held by many readers at once.
+type sessionLock struct {
+	mu      sync.Mutex
+	cond    sync.Cond
+	readers int
+	writer  bool
+}
+
+// tryLock acquires the lock for writing or reading if that is possible without waiting, and returns whether it did.
+func (l *sessionLock) tryLock(write bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.available(write) {
+		return false
+	}
+	l.take(write)
+	return true
+}
+
+// wait waits until the lock can be acquired for writing or reading, and then acquires it.
+func (l *sessionLock) wait(write bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cond.L == nil {
+		l.cond.L = &l.mu
+	}
+	for !l.available(write) {
+		l.cond.Wait()
+	}
+	l.take(write)
+}
+
+// unlock releases the lock that was acquired for writing or reading.
+func (l *sessionLock) unlock(write bool) {
+	l.mu.Lock()
+	if write {
+		l.writer = false
+	} else {
+		l.readers--
+	}
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// available returns whether the lock can be acquired for writing or reading. The mutex must be held while calling this
+// method.
+func (l *sessionLock) available(write bool) bool {
+	return !l.writer && (!write || l.readers == 0)
+}
+
+// take acquires the lock for writing or reading. The mutex must be held while calling this method.
+func (l *sessionLock) take(write bool) {
+	if write {
+		l.writer = true
+	} else {
+		l.readers++
+	}
+}
+
+// lock acquires the components lock of the session for writing, and returns a function that releases it again.
+func (s *Session) lock() func() {
+	s.acquire(true)
+	return s.unlock
+}
+
+// rlock acquires the components lock of the session for reading, and returns a function that releases it again.
+func (s *Session) rlock() func() {
+	s.acquire(false)
+	return s.runlock
+}
+
+func (s *Session) unlock()  { s.release(true) }
+func (s *Session) runlock() { s.release(false) }
+
+// acquire acquires the components lock of the session for writing or reading. Waiting for the lock never finishes if it
+// is held for writing by the handler or query function it is acquired from, so if the slow handler watchdog is enabled,
+// waiting longer than the threshold is logged along with the stack of the goroutine that is waiting.
+func (s *Session) acquire(write bool) {
+	if s.componentsMu.tryLock(write) {
+		return
+	}
+	if threshold := s.m.slowThreshold; threshold > 0 {
+		gid := goroutineId()
+		timer := time.AfterFunc(threshold, func() {
+			s.m.lockWaitTooLong(s, threshold, gid)
+		})
+		defer timer.Stop()
+	}
+	s.componentsMu.wait(write)
+}
+
+// release releases the components lock of the session that was acquired for writing or reading.
+func (s *Session) release(write bool) {
+	s.componentsMu.unlock(write)
+}
+
+// lockWaitTooLong logs that the goroutine with the ID has been waiting for the lock of a session for longer than the
+// threshold. The stack of the goroutine is included at most once per minute, as collecting it briefly stops all
+// goroutines.
+func (m *Manager) lockWaitTooLong(s *Session, threshold time.Duration, gid uint64) {
+	now := time.Now().Unix()
+	if last := m.lastLockStack.Load(); (last != 0 && now-last < statsWindow) || !m.lastLockStack.CAS(last, now) {
+		s.log.Warn("waiting for session lock is taking too long", "threshold", threshold)
+		return
+	}
+	s.log.Warn("waiting for session lock is taking too long", "threshold", threshold, "stack", goroutineStack(gid))
+}
+
+// storeComponent stores the component under the ID in the session. The components lock must be held for writing.
+func (s *Session) storeComponent(cId componentId, c Component) {
+	s.componentsMapMu.Lock()
+	s.components[cId] = c
+	s.componentsMapMu.Unlock()
+}
+
+// deleteComponent deletes the component stored under the ID from the session. The components lock must be held for
+// writing.
+func (s *Session) deleteComponent(cId componentId) {
+	s.componentsMapMu.Lock()
+	delete(s.components, cId)
+	s.componentsMapMu.Unlock()
+}
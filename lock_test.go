@@ -0,0 +1,201 @@
+package peex_test
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/andreashgk/peex"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/player/skin"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+type Counter struct{ N int }
+
+type Marker struct{}
+
+type IncrementHandler struct {
+	Counter peex.Mut[*Counter]
+}
+
+func (h IncrementHandler) HandleJump() {
+	h.Counter.Load().N++
+}
+
+type ReadOwnSessionHandler struct {
+	Session *peex.Session
+	Counter peex.Query[*Counter]
+	Read    *int
+}
+
+func (h ReadOwnSessionHandler) HandleJump() {
+	if c, ok := h.Session.Component(&Counter{}); ok {
+		*h.Read = c.(*Counter).N
+	}
+}
+
+type MutReadOwnSessionHandler struct {
+	Session *peex.Session
+	Counter peex.Mut[*Counter]
+	Ran     *bool
+}
+
+func (h MutReadOwnSessionHandler) HandleJump() {
+	_, *h.Ran = h.Session.Component(&Counter{})
+}
+
+// accept creates a new player and accepts it into a session of the manager with the components.
+func accept(t *testing.T, m *peex.Manager, components ...peex.Component) *peex.Session {
+	t.Helper()
+	s, err := m.Accept(player.New("test", skin.Skin{}, mgl64.Vec3{}), components...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// withTimeout runs the function and fails the test if it does not return in time, which usually means it deadlocked.
+func withTimeout(t *testing.T, f func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out, probably deadlocked")
+	}
+}
+
+func TestReadHandlerWithMutHandlerOnSameEvent(t *testing.T) {
+	read := -1
+	m := peex.New(peex.Config{Handlers: []peex.Handler{
+		IncrementHandler{},
+		ReadOwnSessionHandler{Read: &read},
+	}})
+	s := accept(t, m, &Counter{})
+
+	withTimeout(t, s.HandleJump)
+	if read != 1 {
+		t.Fatalf("read handler saw %v, expected 1", read)
+	}
+}
+
+func TestMutHandlerReadsOwnSession(t *testing.T) {
+	var ran bool
+	m := peex.New(peex.Config{Handlers: []peex.Handler{MutReadOwnSessionHandler{Ran: &ran}}})
+	s := accept(t, m, &Counter{})
+
+	withTimeout(t, s.HandleJump)
+	if !ran {
+		t.Fatal("handler could not read its own session")
+	}
+}
+
+func TestNestedReadQueryWithWaitingWriter(t *testing.T) {
+	m := peex.New(peex.Config{})
+	s := accept(t, m, &Counter{})
+	q := peex.NewQuery1[*Counter](m).Mut()
+
+	var nested bool
+	done := make(chan struct{})
+	withTimeout(t, func() {
+		s.Query(func(c peex.Query[*Counter]) {
+			// A writer waiting for the lock must not keep the query from reading the session again.
+			go func() {
+				defer close(done)
+				q.Run(s, func(c *Counter) { c.N++ })
+			}()
+			time.Sleep(10 * time.Millisecond)
+			nested = s.Query(func(peex.Query[*Counter]) {})
+		})
+	})
+	if !nested {
+		t.Fatal("nested query did not run")
+	}
+	withTimeout(t, func() {
+		<-done
+		s.Query(func(c peex.Query[*Counter]) {
+			if c.Load().N != 1 {
+				t.Errorf("counter is %v, expected the waiting writer to have run once", c.Load().N)
+			}
+		})
+	})
+}
+
+func TestComponentDuringMutQuery(t *testing.T) {
+	m := peex.New(peex.Config{})
+	s := accept(t, m, &Counter{})
+
+	withTimeout(t, func() {
+		s.Query(func(c peex.Mut[*Counter]) {
+			if _, ok := s.Component(&Counter{}); !ok {
+				t.Error("component not found during Mut query")
+			}
+			if comps := peex.AllComponents[*Counter](s); len(comps) != 1 {
+				t.Errorf("found %v components during Mut query, expected 1", len(comps))
+			}
+		})
+	})
+}
+
+func TestLockWaitTooLongIsLogged(t *testing.T) {
+	rec := &recordHandler{msg: "waiting for session lock is taking too long"}
+	m := peex.New(peex.Config{
+		Log:                  slog.New(rec),
+		SlowHandlerThreshold: 10 * time.Millisecond,
+	})
+	s := accept(t, m, &Counter{})
+
+	done := make(chan struct{})
+	s.Query(func(c peex.Mut[*Counter]) {
+		go func() {
+			defer close(done)
+			s.Query(func(peex.Query[*Counter]) {})
+		}()
+		time.Sleep(50 * time.Millisecond)
+	})
+	<-done
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.stacks) != 1 || !rec.stacks[0] {
+		t.Fatalf("expected a single warning with a stack, got %v", rec.stacks)
+	}
+}
+
+// BenchmarkHandleEvent measures the overhead of dispatching an event to a session, which must not include looking up
+// the ID of the goroutine when the session is not locked.
+func BenchmarkHandleEvent(b *testing.B) {
+	benchmarks := map[string][]peex.Handler{
+		"NoHandlers":  nil,
+		"ReadHandler": {ReadOwnSessionHandler{Read: new(int)}},
+		"MutHandler":  {IncrementHandler{}},
+	}
+	for name, handlers := range benchmarks {
+		b.Run(name, func(b *testing.B) {
+			m := peex.New(peex.Config{Handlers: handlers})
+			s, err := m.Accept(player.New("test", skin.Skin{}, mgl64.Vec3{}), &Counter{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.HandleJump()
+			}
+		})
+	}
+}
+
+func TestHandleEventWithoutHandlersDoesNotAllocate(t *testing.T) {
+	m := peex.New(peex.Config{})
+	s := accept(t, m, &Counter{})
+
+	if allocs := testing.AllocsPerRun(100, s.HandleJump); allocs != 0 {
+		t.Fatalf("handling an event without handlers allocated %v times, expected 0", allocs)
+	}
+}
@@ -0,0 +1,103 @@
+package peex
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/df-mc/dragonfly/server"
+)
+
+/// Internal logging logic
+/// ----------------------
+
+// newLogger creates the logger used by the manager from the config. The slog logger is preferred, but if only a
+// server.Logger is provided, it is wrapped so that it can be used as an slog logger. If neither is set, nothing is
+// logged.
+func newLogger(cfg Config) *slog.Logger {
+	switch {
+	case cfg.Log != nil:
+		return cfg.Log
+	case cfg.Logger != nil:
+		return slog.New(&serverLogHandler{l: cfg.Logger})
+	default:
+		return slog.New(discardHandler{})
+	}
+}
+
+// serverLogHandler is an slog.Handler that writes records to a dragonfly server.Logger. Attributes are appended to the
+// message in the key=value format.
+type serverLogHandler struct {
+	l      server.Logger
+	attrs  []slog.Attr
+	groups string
+}
+
+func (h *serverLogHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *serverLogHandler) Handle(_ context.Context, r slog.Record) error {
+	b := &strings.Builder{}
+	b.WriteString(r.Message)
+	for _, a := range h.attrs {
+		writeAttr(b, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(b, h.groups, a)
+		return true
+	})
+
+	switch {
+	case r.Level >= slog.LevelError:
+		h.l.Errorf("%s", b)
+	case r.Level >= slog.LevelWarn:
+		h.l.Warnf("%s", b)
+	case r.Level >= slog.LevelInfo:
+		h.l.Infof("%s", b)
+	default:
+		h.l.Debugf("%s", b)
+	}
+	return nil
+}
+
+func (h *serverLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	n := *h
+	n.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		a.Key = h.groups + a.Key
+		n.attrs = append(n.attrs, a)
+	}
+	return &n
+}
+
+func (h *serverLogHandler) WithGroup(name string) slog.Handler {
+	n := *h
+	n.groups += name + "."
+	return &n
+}
+
+// writeAttr writes an attribute to the builder in the key=value format. Groups are flattened, separating the keys
+// using dots.
+func writeAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			writeAttr(b, prefix+a.Key+".", ga)
+		}
+		return
+	}
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	fmt.Fprintf(b, " %s%s=%q", prefix, a.Key, a.Value.String())
+}
+
+// discardHandler is an slog.Handler that discards every record.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (d discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return d }
+func (d discardHandler) WithGroup(string) slog.Handler           { return d }
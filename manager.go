@@ -1,32 +1,81 @@
 package peex
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"github.com/df-mc/dragonfly/server"
+	"github.com/df-mc/atomic"
 	"github.com/df-mc/dragonfly/server/player"
 	"github.com/google/uuid"
+	"log/slog"
 	"reflect"
-	"strings"
+	"runtime"
+	"runtime/debug"
 	"sync"
+	"time"
 )
 
 // Manager stores all current sessions. It also contains all the registered handlers and component types.
 type Manager struct {
-	logger server.Logger
+	log *slog.Logger
+
+	recoverPanics    bool
+	maxHandlerPanics int
+	errorHandler     func(err HandlerError)
+	metrics          Metrics
+	tracer           Tracer
+	slowThreshold    time.Duration
+	// lastLockStack is the second at which the stack of a goroutine waiting for a session lock was last logged.
+	lastLockStack atomic.Int64
 
 	sessions  map[uuid.UUID]*Session
 	sessionMu sync.RWMutex
 
-	handlerNextId  handlerId
-	handlerIdTable map[reflect.Type]handlerId
-	handlers       map[handlerId]handlerInfo
-	eventHandlers  map[eventId][]handlerId
+	// handlers contains the current handler table, which is replaced whenever a handler is registered or unregistered.
+	handlers   atomic.Value[*handlerTable]
+	handlersMu sync.Mutex
 
 	componentNextId  componentId
 	componentIdTable map[reflect.Type]componentId
+	componentTypes   map[componentId]reflect.Type
+	componentMu      sync.RWMutex
 	componentProvs   map[componentId]ComponentProvider
+	keyedProvs       map[componentId]KeyedComponentProvider
 	// todo: component cache
+
+	// index contains the sessions that have a component, for every type of component.
+	index   map[componentId]map[*Session]struct{}
+	indexMu sync.RWMutex
+
+	queryFuncs   map[reflect.Type]queryFuncInfo
+	queryFuncsMu sync.RWMutex
+
+	// removedBy contains the types of components that are removed after an event, for every event. The component types
+	// for which this has been registered are stored in removalTypes.
+	removedBy    map[eventId][]componentId
+	removalTypes map[componentId]struct{}
+	removalMu    sync.RWMutex
+
+	// globalHandlers contains the global handlers in the order they were registered, and globalEvents contains the
+	// global handlers for every event.
+	globalHandlers []handlerInfo
+	globalEvents   map[eventId][]handlerInfo
+
+	systems []*systemInfo
+	tickMu  sync.Mutex
+
+	// groupBits contains the bit of every handler group, and handlerGroups the bits of the groups every handler type is
+	// in. The bits of the groups that are disabled globally are stored in disabledGroups.
+	groupBits      map[string]uint64
+	handlerGroups  map[reflect.Type]uint64
+	disabledGroups atomic.Uint64
+
+	// resources contains the resource of every type, and resourceTypes the types in the order they were added.
+	// resourceInterfaces contains the interface types that resources have been looked up by.
+	resources          map[reflect.Type]*resource
+	resourceTypes      []reflect.Type
+	resourceInterfaces map[reflect.Type]struct{}
+	resourcesMu        sync.RWMutex
 }
 
 // New creates a new Session Manager. It also inserts all the provided handlers into the manager. Events will be called
@@ -34,49 +83,47 @@ type Manager struct {
 // a player Session in order to actually run.
 func New(cfg Config) *Manager {
 	m := &Manager{
-		logger:           cfg.Logger,
-		sessions:         map[uuid.UUID]*Session{},
-		handlerIdTable:   map[reflect.Type]handlerId{},
-		handlers:         map[handlerId]handlerInfo{},
-		eventHandlers:    map[eventId][]handlerId{},
-		componentIdTable: map[reflect.Type]componentId{},
-		componentProvs:   map[componentId]ComponentProvider{},
+		log:                newLogger(cfg),
+		recoverPanics:      cfg.RecoverPanics,
+		maxHandlerPanics:   cfg.MaxHandlerPanics,
+		errorHandler:       cfg.ErrorHandler,
+		metrics:            cfg.Metrics,
+		tracer:             cfg.Tracer,
+		slowThreshold:      cfg.SlowHandlerThreshold,
+		sessions:           map[uuid.UUID]*Session{},
+		componentIdTable:   map[reflect.Type]componentId{},
+		componentTypes:     map[componentId]reflect.Type{},
+		componentProvs:     map[componentId]ComponentProvider{},
+		keyedProvs:         map[componentId]KeyedComponentProvider{},
+		index:              map[componentId]map[*Session]struct{}{},
+		queryFuncs:         map[reflect.Type]queryFuncInfo{},
+		removedBy:          map[eventId][]componentId{},
+		removalTypes:       map[componentId]struct{}{},
+		globalEvents:       map[eventId][]handlerInfo{},
+		resources:          map[reflect.Type]*resource{},
+		resourceInterfaces: map[reflect.Type]struct{}{},
+		groupBits:          map[string]uint64{},
+		handlerGroups:      map[reflect.Type]uint64{},
 	}
-	for _, id := range allEvents {
-		m.eventHandlers[id] = []handlerId{}
+	if m.tracer == nil {
+		m.tracer = NopTracer{}
 	}
-
-	for _, h := range cfg.Handlers {
-		t := reflect.TypeOf(h)
-		if _, ok := m.handlerIdTable[t]; ok {
-			panic("re-registering an existing handler type")
-		}
-
-		// Assign the handler ID to the type, and generate the handlerInfo
-		m.handlerIdTable[t] = m.handlerNextId
-		info := m.createHandlerInfo(h)
-		m.handlers[m.handlerNextId] = info
-		for id, _ := range info.events {
-			m.eventHandlers[id] = append(m.eventHandlers[id], m.handlerNextId)
-		}
-
-		// Check if the handler (partially) implements a possibly outdated version of player.Handler, preventing events
-		// from being silently ignored.
-		for eventName, id := range allEvents {
-			if _, ok := info.events[id]; ok {
-				continue
-			}
-
-			// If the handler does have the method but does not implement the one specified in Peex it is probably an
-			// outdated handler method.
-			methodName := "Handle" + strings.TrimPrefix(eventName, "event")
-			if _, ok := t.MethodByName(methodName); ok {
-				panic("incompatible handler method: " + methodName + " (is Peex or the handler outdated?)")
-			}
+	m.registerGroups(cfg.Groups)
+	// Resources are added first, so that handlers can find their resources when they are registered.
+	for _, r := range cfg.Resources {
+		if _, ok := m.resources[reflect.TypeOf(r)]; ok {
+			panic(fmt.Errorf("cannot register multiple resources of the same type (%T)", r))
 		}
+		m.SetResource(r)
+	}
 
-		// Make sure to increment the handlerId for the next handler!
-		m.handlerNextId++
+	handlers := newHandlerTable()
+	for _, h := range cfg.Handlers {
+		m.addHandler(handlers, h)
+	}
+	m.handlers.Store(handlers)
+	for _, h := range cfg.GlobalHandlers {
+		m.registerGlobal(h)
 	}
 	for _, p := range cfg.Providers {
 		id := p.componentId(m)
@@ -85,9 +132,37 @@ func New(cfg Config) *Manager {
 		}
 		m.componentProvs[id] = p
 	}
+	for _, sys := range cfg.Systems {
+		m.systems = append(m.systems, m.createSystemInfo(sys))
+	}
+	for _, p := range cfg.KeyedProviders {
+		id := p.componentId(m)
+		if _, ok := m.keyedProvs[id]; ok {
+			panic("cannot register multiple keyed providers for the same component (" + p.componentName() + ")")
+		}
+		m.keyedProvs[id] = p
+	}
 	return m
 }
 
+// EnableHandler enables a handler or system that was disabled because it panicked too often. The handler is identified
+// by its type, so any value of the same type as the registered handler can be passed. Its panic count is also reset.
+func (m *Manager) EnableHandler(h Handler) {
+	state, ok := m.handlerState(h)
+	if !ok {
+		panic("trying to enable a handler that was never registered")
+	}
+	state.panics.Store(0)
+	state.disabled.Store(false)
+}
+
+// HandlerEnabled returns whether the handler or system of the same type as the argument is currently enabled. Handlers
+// are only disabled when they panicked too often.
+func (m *Manager) HandlerEnabled(h Handler) bool {
+	state, ok := m.handlerState(h)
+	return ok && !state.disabled.Load()
+}
+
 // Accept assigns a Session to a player. This also works for disconnected players or fake players. Initial components
 // can be provided for the player to start with. The add function will be called on any component that implements Adder.
 // Providing multiple components of the same type is not allowed and will return an error.
@@ -100,19 +175,36 @@ func (m *Manager) Accept(p *player.Player, components ...Component) (*Session, e
 	}
 	s := &Session{
 		m:          m,
+		id:         p.UUID(),
+		log:        m.log.With("player.uuid", p.UUID().String(), "player.name", p.Name()),
 		components: make(map[componentId]Component),
 	}
 	s.p.Store(p)
 	p.Handle(s)
-	// Insert all the components into the session. No mutex lock is needed, as it is not yet possible for any other
-	// goroutine to have access to the session yet.
+	// The session is stored before any of its components are indexed, so that every session found through the index is
+	// also stored in the manager. It is locked until all the components are inserted, so that other goroutines that find
+	// it through the index do not see it before it is complete.
+	m.sessions[p.UUID()] = s
+	unlock := s.lock()
+	defer unlock()
 	for _, comp := range components {
-		err := s.insertComponent(m.getComponentId(comp), comp)
+		err := s.insertComponent(m.getComponentId(comp), comp, 0)
 		if err != nil {
+			// The session is removed again, so it should not remain in the index either.
+			for cId := range s.components {
+				m.indexRemove(cId, s)
+				s.cancelRemoval(cId)
+			}
+			delete(m.sessions, p.UUID())
+			s.componentsMapMu.Lock()
+			s.components = nil
+			s.componentsMapMu.Unlock()
 			return nil, err
 		}
 	}
-	m.sessions[p.UUID()] = s
+	if m.metrics != nil {
+		m.metrics.SetSessions(len(m.sessions))
+	}
 	return s, nil
 }
 
@@ -147,8 +239,12 @@ func (m *Manager) SessionFromUUID(id uuid.UUID) (*Session, bool) {
 // component has no provider or there was a provider error, the query will not run. Loaded components will be saved
 // again.
 // Returns any error that occurred and whether the query ran. Should be handled independently.
-func (m *Manager) QueryID(id uuid.UUID, queryFunc any) (bool, error) {
+func (m *Manager) QueryID(id uuid.UUID, queryFunc any) (ran bool, err error) {
 	info := m.makeQueryFuncInfo(queryFunc)
+	_, span := m.tracer.Start(context.Background(), "peex.query_id", Attribute{Key: "player.uuid", Value: id.String()})
+	defer func() {
+		span.End(err)
+	}()
 
 	m.sessionMu.RLock()
 	defer m.sessionMu.RUnlock()
@@ -158,17 +254,29 @@ func (m *Manager) QueryID(id uuid.UUID, queryFunc any) (bool, error) {
 	args := make([]reflect.Value, 0, len(info.params))
 	var compSaveQueue []any
 	var compSaveIds []componentId
+	// Changes made through Mut queries are either written back to the session, or to the loaded component before it is
+	// saved, which is stored under its index in the save queue.
+	var writes []pendingWrite
+	loadedWrites := map[int]writerQuery{}
 
 	if hasSession {
-		s.componentsMu.RLock()
-		defer s.componentsMu.RUnlock()
+		s.acquire(info.mutable)
+		defer s.release(info.mutable)
 	}
 	// Retrieve or load all required components.
 	for _, param := range info.params {
+		if param.tx {
+			panic("*Tx cannot be used in a query by UUID")
+		}
+		if param.res != nil {
+			args = append(args, param.resource())
+			continue
+		}
+		queued := len(compSaveQueue)
 		c, ok, err := func() (any, bool, error) {
 			// Case 1: the player is online and has the component.
 			if hasSession {
-				c, ok := s.components[param.cId]
+				_, c, ok := s.queryComponent(param.cId)
 				if ok {
 					return c, true, nil
 				}
@@ -180,7 +288,7 @@ func (m *Manager) QueryID(id uuid.UUID, queryFunc any) (bool, error) {
 				return nil, false, nil
 			}
 
-			v, err := p.loadNew(id)
+			v, err := m.loadNewComponent(p, param.cId, id)
 			compSaveQueue = append(compSaveQueue, v)
 			compSaveIds = append(compSaveIds, param.cId)
 			if err != nil {
@@ -195,7 +303,13 @@ func (m *Manager) QueryID(id uuid.UUID, queryFunc any) (bool, error) {
 				args = append(args, reflect.ValueOf(c))
 				continue
 			}
-			args = append(args, reflect.ValueOf(param.query.set(c)))
+			q := param.query.set(c)
+			if w, ok := q.(writerQuery); ok && len(compSaveQueue) > queued {
+				loadedWrites[queued] = w
+			} else {
+				writes = trackWrite(writes, s, param.cId, q)
+			}
+			args = append(args, reflect.ValueOf(q))
 		} else if err != nil {
 			return false, err
 		} else if !ok {
@@ -208,6 +322,12 @@ func (m *Manager) QueryID(id uuid.UUID, queryFunc any) (bool, error) {
 	}
 
 	val.Call(args)
+	applyWrites(writes)
+	for i, w := range loadedWrites {
+		if v, ok := w.written(); ok {
+			compSaveQueue[i] = v
+		}
+	}
 	// Save all the components that are were loaded because of this query.
 	for i, c := range compSaveQueue {
 		p, ok := m.componentProvs[compSaveIds[i]]
@@ -216,7 +336,7 @@ func (m *Manager) QueryID(id uuid.UUID, queryFunc any) (bool, error) {
 			panic("component does not have a provider")
 		}
 		// Try actually save it
-		err := p.save(id, c)
+		err := m.saveComponent(p, compSaveIds[i], id, c)
 		if err != nil {
 			return true, fmt.Errorf("error saving component: %w", err)
 		}
@@ -228,14 +348,145 @@ func (m *Manager) QueryID(id uuid.UUID, queryFunc any) (bool, error) {
 // separately (albeit slightly faster). A number of players on which the query executed successfully is returned.
 func (m *Manager) QueryAll(queryFunc any) int {
 	info := m.makeQueryFuncInfo(queryFunc)
+	return m.each(info.requiredComponents(), func(s *Session) bool {
+		return s.query(queryFunc, info)
+	})
+}
+
+// QueryAllParallel works the same as QueryAll, but runs the query function on multiple sessions at the same time using
+// the amount of workers specified. If workers is zero or less, runtime.GOMAXPROCS(0) workers are used. The query function
+// must therefore be safe to run in multiple goroutines at once. It never runs on the same session twice at the same
+// time, and the session is locked in the same way as a normal query while it runs.
+// Returns the number of sessions the query ran on, and a PanicError for every session the query function panicked on.
+// The errors are ordered by the UUID of the session, regardless of the order in which the sessions were handled.
+func (m *Manager) QueryAllParallel(queryFunc any, workers int) (int, []error) {
+	info := m.makeQueryFuncInfo(queryFunc)
+	_, span := m.tracer.Start(context.Background(), "peex.query_all_parallel")
+	defer span.End(nil)
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
 
-	count := 0
 	m.sessionMu.RLock()
-	for _, s := range m.sessions {
-		if s.query(queryFunc, info) {
+	defer m.sessionMu.RUnlock()
+	sessions := m.indexedSessions(info.requiredComponents())
+	sortSessions(sessions)
+
+	// Every session has its own slot for the results, so no additional synchronisation is needed.
+	ran := make([]bool, len(sessions))
+	panics := make([]error, len(sessions))
+	var next atomic.Int32
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(sessions)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Inc()) - 1; i < len(sessions); i = int(next.Inc()) - 1 {
+				ran[i], panics[i] = m.queryRecover(sessions[i], queryFunc, info)
+			}
+		}()
+	}
+	wg.Wait()
+
+	count := 0
+	var errs []error
+	for i := range sessions {
+		if ran[i] {
 			count++
 		}
+		if panics[i] != nil {
+			errs = append(errs, panics[i])
+		}
 	}
-	m.sessionMu.RUnlock()
-	return count
+	return count, errs
+}
+
+// QueryMany runs a single query function on multiple sessions at once, which is useful for logic involving multiple
+// players such as trades or duels. The parameters of the query function are split into equally sized groups, one for
+// each session in the order they were provided. For example, a query function for two sessions with the parameters
+// (a1 Query[*A], a2 Query[*B], b1 Query[*A], b2 Query[*B]) will have a1 and a2 set from the first session and b1 and b2
+// from the second one. A *Tx parameter may be added anywhere to defer structural changes, and so can Res parameters.
+// The sessions are locked in a stable order, so multiple QueryMany calls on the same sessions cannot deadlock. The query
+// only runs if every session has all the required components. Returns whether the query ran, and the last error that
+// occurred while applying the transaction (if any).
+func (m *Manager) QueryMany(sessions []*Session, queryFunc any) (bool, error) {
+	info := m.makeQueryFuncInfo(queryFunc)
+	if len(sessions) == 0 || info.queries%len(sessions) != 0 {
+		panic(fmt.Errorf("query func has %d query parameters, which cannot be split over %d sessions", info.queries, len(sessions)))
+	}
+	groupSize := info.queries / len(sessions)
+
+	tx := &Tx{}
+	ran, err := func() (bool, error) {
+		unlock, err := lockSessions(sessions, false)
+		if err != nil {
+			return false, err
+		}
+		defer unlock()
+
+		args := make([]reflect.Value, 0, len(info.params))
+		var writes []pendingWrite
+		queryNum := 0
+		for _, param := range info.params {
+			if param.tx {
+				args = append(args, reflect.ValueOf(tx))
+				continue
+			}
+			if param.res != nil {
+				args = append(args, param.resource())
+				continue
+			}
+			s := sessions[queryNum/groupSize]
+			queryNum++
+
+			paramArgs, paramWrites, ok := s.queryArgs([]queryFuncParam{param}, tx)
+			if !ok {
+				return false, nil
+			}
+			args = append(args, paramArgs...)
+			writes = append(writes, paramWrites...)
+		}
+
+		reflect.ValueOf(queryFunc).Call(args)
+		applyWrites(writes)
+		return true, nil
+	}()
+	if err != nil {
+		return false, err
+	}
+	return ran, tx.apply()
+}
+
+/// Internal manager logic
+/// ----------------------
+
+// handlerState returns the state of the handler or system with the same type as the argument.
+func (m *Manager) handlerState(h Handler) (*handlerState, bool) {
+	t := reflect.TypeOf(h)
+	handlers := m.handlers.Load()
+	if id, ok := handlers.ids[t]; ok {
+		return handlers.handlers[id].state, true
+	}
+	for _, info := range m.globalHandlers {
+		if info.typ == t {
+			return info.state, true
+		}
+	}
+	for _, sys := range m.systems {
+		if sys.info.typ == t {
+			return sys.info.state, true
+		}
+	}
+	return nil, false
+}
+
+// queryRecover runs a query function on the session, recovering any panic that occurs. A recovered panic is returned as
+// a PanicError.
+func (m *Manager) queryRecover(s *Session, queryFunc any, info queryFuncInfo) (ran bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = PanicError{Session: s, Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return s.query(queryFunc, info), nil
 }
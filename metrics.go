@@ -0,0 +1,260 @@
+package peex
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics receives measurements made by a Manager. An implementation can be passed in the Config to export these to a
+// monitoring system. The methods may be called from multiple goroutines at once, and should return quickly as they are
+// called while handling events.
+type Metrics interface {
+	// ObserveEvent is called after an event has been handled by all handlers, with the total time this took.
+	ObserveEvent(event string, d time.Duration)
+	// ObserveHandler is called for every handler that implements an event. Matched is false if the handler was skipped
+	// because its queries did not match, in which case the duration is always zero.
+	ObserveHandler(handler, event string, matched bool, d time.Duration)
+	// ObserveProvider is called after a provider loaded or saved a component. The operation is either "load" or "save",
+	// and the error is the one returned by the provider.
+	ObserveProvider(component, op string, d time.Duration, err error)
+	// SetSessions is called with the new amount of sessions every time a session is added or removed.
+	SetSessions(n int)
+	// AddComponents is called when components of a type are added to (positive delta) or removed from (negative delta)
+	// any session.
+	AddComponents(component string, delta int)
+}
+
+// PrometheusMetrics is a Metrics implementation that keeps all measurements in memory. It implements http.Handler,
+// serving the measurements in the Prometheus text format so that it can be scraped directly.
+type PrometheusMetrics struct {
+	mu sync.Mutex
+
+	buckets []float64
+
+	events         map[string]*histogram
+	handlerRuns    map[[3]string]uint64
+	handlers       map[[2]string]*histogram
+	providers      map[[2]string]*histogram
+	providerErrors map[[2]string]uint64
+	sessions       int
+	components     map[string]int
+}
+
+// DefaultBuckets are the histogram buckets used by PrometheusMetrics if none are specified, in seconds. They are
+// focussed on the short durations events usually take.
+var DefaultBuckets = []float64{0.00001, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// NewPrometheusMetrics creates a new PrometheusMetrics using the provided histogram buckets, which are in seconds. The
+// DefaultBuckets are used if no buckets are provided.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &PrometheusMetrics{
+		buckets:        buckets,
+		events:         map[string]*histogram{},
+		handlerRuns:    map[[3]string]uint64{},
+		handlers:       map[[2]string]*histogram{},
+		providers:      map[[2]string]*histogram{},
+		providerErrors: map[[2]string]uint64{},
+		components:     map[string]int{},
+	}
+}
+
+// ObserveEvent ...
+func (p *PrometheusMetrics) ObserveEvent(event string, d time.Duration) {
+	p.mu.Lock()
+	histogramFor(p.events, event, p.buckets).observe(d)
+	p.mu.Unlock()
+}
+
+// ObserveHandler ...
+func (p *PrometheusMetrics) ObserveHandler(handler, event string, matched bool, d time.Duration) {
+	result := "skipped"
+	if matched {
+		result = "matched"
+	}
+
+	p.mu.Lock()
+	p.handlerRuns[[3]string{handler, event, result}]++
+	if matched {
+		histogramFor(p.handlers, [2]string{handler, event}, p.buckets).observe(d)
+	}
+	p.mu.Unlock()
+}
+
+// ObserveProvider ...
+func (p *PrometheusMetrics) ObserveProvider(component, op string, d time.Duration, err error) {
+	key := [2]string{component, op}
+
+	p.mu.Lock()
+	histogramFor(p.providers, key, p.buckets).observe(d)
+	if err != nil {
+		p.providerErrors[key]++
+	}
+	p.mu.Unlock()
+}
+
+// SetSessions ...
+func (p *PrometheusMetrics) SetSessions(n int) {
+	p.mu.Lock()
+	p.sessions = n
+	p.mu.Unlock()
+}
+
+// AddComponents ...
+func (p *PrometheusMetrics) AddComponents(component string, delta int) {
+	p.mu.Lock()
+	p.components[component] += delta
+	p.mu.Unlock()
+}
+
+// ServeHTTP writes all measurements in the Prometheus text format.
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = p.WriteTo(w)
+}
+
+// WriteTo writes all measurements in the Prometheus text format to the writer.
+func (p *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	b := &strings.Builder{}
+
+	p.mu.Lock()
+	writeHeader(b, "peex_event_duration_seconds", "histogram", "Time it took for all handlers to handle an event.")
+	for _, event := range sortedKeys(p.events) {
+		p.events[event].write(b, "peex_event_duration_seconds", labels("event", event))
+	}
+
+	writeHeader(b, "peex_handler_runs_total", "counter", "Amount of times a handler was matched or skipped for an event.")
+	runs := make([][3]string, 0, len(p.handlerRuns))
+	for key := range p.handlerRuns {
+		runs = append(runs, key)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return strings.Join(runs[i][:], "\x00") < strings.Join(runs[j][:], "\x00")
+	})
+	for _, key := range runs {
+		fmt.Fprintf(b, "peex_handler_runs_total%s %d\n", labels("handler", key[0], "event", key[1], "result", key[2]), p.handlerRuns[key])
+	}
+
+	writeHeader(b, "peex_handler_duration_seconds", "histogram", "Time it took for a handler to handle an event.")
+	for _, key := range sortedPairs(p.handlers) {
+		p.handlers[key].write(b, "peex_handler_duration_seconds", labels("handler", key[0], "event", key[1]))
+	}
+
+	writeHeader(b, "peex_provider_duration_seconds", "histogram", "Time it took for a provider to load or save a component.")
+	for _, key := range sortedPairs(p.providers) {
+		p.providers[key].write(b, "peex_provider_duration_seconds", labels("component", key[0], "op", key[1]))
+	}
+
+	writeHeader(b, "peex_provider_errors_total", "counter", "Amount of errors returned by a provider.")
+	for _, key := range sortedPairs(p.providerErrors) {
+		fmt.Fprintf(b, "peex_provider_errors_total%s %d\n", labels("component", key[0], "op", key[1]), p.providerErrors[key])
+	}
+
+	writeHeader(b, "peex_sessions", "gauge", "Amount of sessions currently in the manager.")
+	fmt.Fprintf(b, "peex_sessions %d\n", p.sessions)
+
+	writeHeader(b, "peex_components", "gauge", "Amount of components of a type currently in all sessions.")
+	for _, component := range sortedKeys(p.components) {
+		fmt.Fprintf(b, "peex_components%s %d\n", labels("component", component), p.components[component])
+	}
+	p.mu.Unlock()
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+/// Internal metrics logic
+/// ----------------------
+
+// histogram is a cumulative histogram of durations, measured in seconds.
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	v := d.Seconds()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// write writes the histogram to the builder. The labels must be formatted using the labels function.
+func (h *histogram) write(b *strings.Builder, name, labels string) {
+	// The le label has to be added to the existing labels.
+	prefix := strings.TrimSuffix(labels, "}") + ","
+	for i, upper := range h.buckets {
+		fmt.Fprintf(b, "%s_bucket%sle=\"%g\"} %d\n", name, prefix, upper, h.counts[i])
+	}
+	fmt.Fprintf(b, "%s_bucket%sle=\"+Inf\"} %d\n", name, prefix, h.count)
+	fmt.Fprintf(b, "%s_sum%s %g\n", name, labels, h.sum)
+	fmt.Fprintf(b, "%s_count%s %d\n", name, labels, h.count)
+}
+
+// histogramFor returns the histogram stored under the key, creating it if it does not exist yet.
+func histogramFor[K comparable](m map[K]*histogram, key K, buckets []float64) *histogram {
+	h, ok := m[key]
+	if !ok {
+		h = newHistogram(buckets)
+		m[key] = h
+	}
+	return h
+}
+
+func writeHeader(b *strings.Builder, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats pairs of label names and values in the Prometheus format.
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+"=\""+labelEscaper.Replace(pairs[i+1])+"\"")
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedPairs[V any](m map[[2]string]V) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
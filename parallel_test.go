@@ -0,0 +1,82 @@
+package peex_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andreashgk/peex"
+)
+
+func TestQueryAllParallel(t *testing.T) {
+	const sessions, workers = 12, 3
+	m := peex.New(peex.Config{})
+	for i := 0; i < sessions; i++ {
+		if i%3 == 0 {
+			accept(t, m, &Counter{}, &Marker{})
+			continue
+		}
+		accept(t, m, &Counter{})
+	}
+	// A session without a counter, which must not be queried.
+	accept(t, m, &Marker{})
+
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	var count int
+	var errs []error
+	withTimeout(t, func() {
+		count, errs = m.QueryAllParallel(func(c peex.Mut[*Counter], marker peex.Option[*Marker]) {
+			mu.Lock()
+			active++
+			maxActive = max(maxActive, active)
+			mu.Unlock()
+			// Give the other workers time to pick up a session as well.
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			active--
+			mu.Unlock()
+
+			c.Load().N++
+			if _, ok := marker.Load(); ok {
+				panic("marked")
+			}
+		}, workers)
+	})
+
+	if count != sessions-sessions/3 {
+		t.Errorf("query ran on %v sessions, expected %v", count, sessions-sessions/3)
+	}
+	if maxActive < 2 || maxActive > workers {
+		t.Errorf("query ran on %v sessions at once, expected between 2 and %v", maxActive, workers)
+	}
+	for _, s := range peex.SessionsWith[*Counter](m) {
+		c, _ := s.Component(&Counter{})
+		if n := c.(*Counter).N; n != 1 {
+			t.Errorf("query ran %v times on a session, expected once", n)
+		}
+	}
+
+	if len(errs) != sessions/3 {
+		t.Fatalf("got %v errors, expected %v", len(errs), sessions/3)
+	}
+	for i, err := range errs {
+		p, ok := err.(peex.PanicError)
+		if !ok {
+			t.Fatalf("expected a PanicError, got %T", err)
+		}
+		if p.Value != "marked" || len(p.Stack) == 0 {
+			t.Errorf("unexpected panic error %v", p)
+		}
+		if _, ok := p.Session.Component(&Marker{}); !ok {
+			t.Errorf("panic error for a session that did not panic")
+		}
+		if i > 0 {
+			prev, id := errs[i-1].(peex.PanicError).Session.Player().UUID(), p.Session.Player().UUID()
+			if bytes.Compare(prev[:], id[:]) >= 0 {
+				t.Errorf("errors are not ordered by session UUID")
+			}
+		}
+	}
+}
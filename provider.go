@@ -1,8 +1,10 @@
 package peex
 
 import (
+	"context"
 	"github.com/google/uuid"
 	"reflect"
+	"time"
 )
 
 // GenericProvider represent a struct that can load & save data associated to a player for a certain component.
@@ -65,6 +67,49 @@ func (p ProviderWrapper[c]) componentId(m *Manager) componentId {
 }
 
 func (p ProviderWrapper[c]) componentName() string {
-	t := reflect.TypeOf(new(c))
-	return t.Name()
+	t := reflect.TypeOf(new(c)).Elem()
+	return t.String()
+}
+
+// loadComponent loads a component using its provider, reporting the time it took to the metrics and tracer.
+func (m *Manager) loadComponent(p ComponentProvider, cId componentId, id uuid.UUID, x any) error {
+	return m.observeProvider("load", cId, id, func() error {
+		return p.load(id, x)
+	})
+}
+
+// loadNewComponent loads a new instance of a component using its provider, reporting the time it took to the metrics
+// and tracer.
+func (m *Manager) loadNewComponent(p ComponentProvider, cId componentId, id uuid.UUID) (v any, err error) {
+	err = m.observeProvider("load", cId, id, func() error {
+		v, err = p.loadNew(id)
+		return err
+	})
+	return v, err
+}
+
+// saveComponent saves a component using its provider, reporting the time it took to the metrics and tracer.
+func (m *Manager) saveComponent(p ComponentProvider, cId componentId, id uuid.UUID, x any) error {
+	return m.observeProvider("save", cId, id, func() error {
+		return p.save(id, x)
+	})
+}
+
+// observeProvider runs a provider operation, reporting it to the metrics and tracer if they are enabled.
+func (m *Manager) observeProvider(op string, cId componentId, id uuid.UUID, f func() error) error {
+	if m.metrics == nil && !m.tracing() {
+		return f()
+	}
+	name := m.componentName(cId)
+	_, span := m.tracer.Start(context.Background(), "peex.provider."+op,
+		Attribute{Key: "player.uuid", Value: id.String()},
+		Attribute{Key: "component", Value: name},
+	)
+	start := time.Now()
+	err := f()
+	if m.metrics != nil {
+		m.metrics.ObserveProvider(name, op, time.Since(start), err)
+	}
+	span.End(err)
+	return err
 }
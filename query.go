@@ -6,12 +6,26 @@ import (
 )
 
 // Query is used to query for a certain component type, passing its value to the handler. Query.Load() can be used to
-// get the value.
+// get the value. The component is only locked for reading, so it must not be modified: use Mut instead if the handler
+// changes the component.
 type Query[c Component] struct {
 	With[c]
 	val c
 }
 
+// Mut is used to query for a certain component type that is modified by the handler. It works like Query, but the
+// session is locked for writing while the handler runs instead of for reading, so no other goroutine can access the
+// session's components at the same time. Other handlers of the same event are not affected by this. A handler with a
+// Mut query may still look up components of its own session using Session.Component, but must not query or change it:
+// methods such as Session.InsertComponent wait for the lock forever. Use a *Tx for structural changes instead.
+// Mut.Load() can be used to get the value.
+// Mut can also be used to replace the value of the component using Mut.Set() or Mut.Update(), which allows components
+// that are not pointers to be modified. The new value is written back to the session once the handler returns.
+type Mut[c Component] struct {
+	With[c]
+	val *mutValue[c]
+}
+
 // Option is a query that allows the query to specify whether a certain Component is present in the session, passing
 // along its value if it exists. This value can be accessed through Option.Load().
 type Option[c Component] struct {
@@ -24,16 +38,68 @@ type Option[c Component] struct {
 // value of the component itself is not important.
 type With[c Component] struct{}
 
+// Target is used in handlers to query the components of the entity involved in an event, such as the entity that was
+// attacked in HandleAttackEntity. The handler only runs if this entity is a player with a Session that matches the
+// wrapped query, which can be any other query type. For example, Target[Query[*Team]] will pass along the Team of the
+// player that was attacked. Target can only be used for HandleAttackEntity, HandleItemUseOnEntity and HandleItemDrop:
+// handlers with a Target field will never run for any other event.
+// The session of the target is locked while a handler with a Target field runs, so the handler must not modify that
+// session directly: methods such as Session.InsertComponent wait for the lock forever when called on it. Handlers without
+// a Target field do not lock the session of the target, so they can modify it freely.
+type Target[q queryType] struct {
+	query q
+	s     *Session
+}
+
 // Load returns the underlying value of the Query.
 func (q Query[c]) Load() c {
 	return q.val
 }
 
+// Load returns the underlying value of the Mut query, which may be modified. If the value was changed using Set or
+// Update, the new value is returned.
+func (m Mut[c]) Load() c {
+	if m.val == nil {
+		var zero c
+		return zero
+	}
+	return m.val.v
+}
+
+// Set replaces the value of the component. The new value is stored in the session after the handler or query function
+// returns. The Add and Remove methods of the component are not called. If c is an interface type, the new value must have
+// the same type as the component it replaces, otherwise Set panics.
+func (m Mut[c]) Set(v c) {
+	m.val.check(v)
+	m.val.v = v
+	m.val.changed = true
+}
+
+// Update calls the function with a pointer to the value of the component, after which the value is stored in the session
+// in the same way as Set.
+func (m Mut[c]) Update(f func(v *c)) {
+	v := m.val.v
+	f(&v)
+	m.val.check(v)
+	m.val.v = v
+	m.val.changed = true
+}
+
 // Load returns the queried value, along with whether it actually exists.
 func (o Option[c]) Load() (c, bool) {
 	return o.val, o.has
 }
 
+// Load returns the query that was run on the Session of the targeted player.
+func (t Target[q]) Load() q {
+	return t.query
+}
+
+// Session returns the Session of the targeted player.
+func (t Target[q]) Session() *Session {
+	return t.s
+}
+
 /// Internal query logic
 /// --------------------
 
@@ -42,6 +108,39 @@ func (q Query[c]) set(x any) queryType {
 	return q
 }
 
+func (m Mut[c]) set(x any) queryType {
+	m.val = &mutValue[c]{v: x.(c), typ: reflect.TypeOf(x)}
+	return m
+}
+
+func (m Mut[c]) written() (any, bool) {
+	if m.val == nil || !m.val.changed {
+		return nil, false
+	}
+	return m.val.v, true
+}
+
+// mutValue holds the value of a Mut query. It is shared between all copies of the query, so that changes made in the
+// handler can be written back to the session afterwards.
+type mutValue[c Component] struct {
+	v       c
+	changed bool
+	// typ is the type of the component that was queried, which may differ from c for queries on interface types.
+	typ reflect.Type
+}
+
+// check panics if the new value does not have the type of the queried component. Values of another type would otherwise
+// be stored under the ID of the queried component, which can only happen for queries on interface types.
+func (v *mutValue[c]) check(n c) {
+	if t := reflect.TypeOf(n); t != v.typ {
+		panic(fmt.Errorf("cannot replace component of type %v with a value of type %v", v.typ, t))
+	}
+}
+
+func (m Mut[c]) mutable() bool {
+	return true
+}
+
 func (w With[c]) getType() reflect.Type {
 	v := new(c)
 	return reflect.TypeOf(v).Elem()
@@ -51,6 +150,10 @@ func (w With[c]) optional() bool {
 	return false
 }
 
+func (w With[c]) mutable() bool {
+	return false
+}
+
 func (w With[c]) set(x any) queryType { return w }
 
 func (o Option[c]) optional() bool {
@@ -63,55 +166,150 @@ func (o Option[c]) set(x any) queryType {
 	return o
 }
 
+// writerQuery is a query that can change the value of a component, which has to be written back to the session after
+// the handler or query function returns.
+type writerQuery interface {
+	queryType
+	// written returns the new value of the component, or false if it was not changed.
+	written() (any, bool)
+}
+
+// pendingWrite is a query that may have changed a component of a session.
+type pendingWrite struct {
+	s   *Session
+	cId componentId
+	q   writerQuery
+}
+
+// trackWrite adds the query to the pending writes if it is able to change the component.
+func trackWrite(writes []pendingWrite, s *Session, cId componentId, q any) []pendingWrite {
+	if w, ok := q.(writerQuery); ok {
+		writes = append(writes, pendingWrite{s: s, cId: cId, q: w})
+	}
+	return writes
+}
+
+// applyWrites writes back the changed components of all the pending writes. The sessions must be locked for writing.
+func applyWrites(writes []pendingWrite) {
+	for _, w := range writes {
+		if v, ok := w.q.written(); ok {
+			w.s.storeComponent(w.cId, v)
+		}
+	}
+}
+
 type queryType interface {
 	getType() reflect.Type
 	optional() bool
+	// mutable returns whether the component is modified through the query, which requires the session to be locked for
+	// writing.
+	mutable() bool
 	set(x any) queryType
 }
 
+func (t Target[q]) inner() queryType {
+	return t.query
+}
+
+func (t Target[q]) setTarget(s *Session, x queryType) targetType {
+	t.query = x.(q)
+	t.s = s
+	return t
+}
+
+type targetType interface {
+	// inner returns the query wrapped by the target type.
+	inner() queryType
+	setTarget(s *Session, x queryType) targetType
+}
+
 // query function stuff
 
 type queryFuncInfo struct {
 	params []queryFuncParam
+	// queries is the amount of parameters that query a component, so every parameter that is not a *Tx or Res.
+	queries int
+	// mutable is true if any of the parameters is a Mut query.
+	mutable bool
 }
 
 type queryFuncParam struct {
 	cId      componentId
 	optional bool
 	direct   bool
+	tx       bool
+	// res is the resource passed to the parameter if it is a Res, in which case resArg is the empty Res.
+	res    *resource
+	resArg resourceType
 
 	query queryType
 }
 
+// resource returns the argument of a Res parameter, which holds the current value of the resource.
+func (p queryFuncParam) resource() reflect.Value {
+	return reflect.ValueOf(p.resArg.setResource(p.res.v.Load()))
+}
+
+// makeQueryFuncInfo returns the info of a query function. The info only depends on the type of the function, so it is
+// cached to avoid inspecting the same function type over and over again.
 func (m *Manager) makeQueryFuncInfo(f any) queryFuncInfo {
 	t := reflect.TypeOf(f)
-	if t.Kind() != reflect.Func {
-		panic(fmt.Errorf("expected a function, got %s", t.String()))
+	if t == nil || t.Kind() != reflect.Func {
+		panic(fmt.Errorf("expected a function, got %T", f))
+	}
+
+	m.queryFuncsMu.RLock()
+	info, ok := m.queryFuncs[t]
+	m.queryFuncsMu.RUnlock()
+	if ok {
+		return info
 	}
 
+	// If creating the info panics, nothing is cached and the function will panic again the next time it is used.
+	info = m.compileQueryFunc(t)
+	m.queryFuncsMu.Lock()
+	m.queryFuncs[t] = info
+	m.queryFuncsMu.Unlock()
+	return info
+}
+
+// compileQueryFunc creates the info of a query function with the type.
+func (m *Manager) compileQueryFunc(t reflect.Type) queryFuncInfo {
 	info := queryFuncInfo{}
 	for i := 0; i < t.NumIn(); i++ {
 		param := queryFuncParam{}
 
 		in := t.In(i)
-		if cId, ok := m.componentIdTable[in]; ok {
+		if in == reflect.TypeOf((*Tx)(nil)) {
+			param.tx = true
+			info.params = append(info.params, param)
+			continue
+		}
+		if r, ok := reflect.Zero(in).Interface().(resourceType); ok {
+			param.res, param.resArg = m.mustResource(r.resourceType(), "query func"), r
+			info.params = append(info.params, param)
+			continue
+		}
+
+		if cId, ok := m.lookupComponentId(in); ok {
 			param.cId = cId
 			param.direct = true
 		} else {
 			var ok bool
-			param.query, ok = reflect.New(in).Interface().(queryType)
+			param.query, ok = reflect.Zero(in).Interface().(queryType)
 			if !ok {
-				panic("query func must only have query types (Query, With, Option)")
+				panic("query func must only have query types (Query, Mut, With, Option), Res or *Tx")
 			}
+			param.optional = param.query.optional()
+			info.mutable = info.mutable || param.query.mutable()
 
-			param.cId, ok = m.componentIdTable[param.query.getType()]
-			// If the component is not registered, the player does not have this component
-			if !ok {
-				continue
-			}
+			// If the component is not registered yet, no player has this component. It still needs an ID for the
+			// parameter to be passed along correctly.
+			param.cId = m.getComponentIdRefl(param.query.getType())
 		}
 
 		info.params = append(info.params, param)
+		info.queries++
 	}
 	return info
 }
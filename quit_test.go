@@ -0,0 +1,35 @@
+package peex_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/andreashgk/peex"
+	"github.com/google/uuid"
+)
+
+type FailingCounterProvider struct{}
+
+func (FailingCounterProvider) Load(uuid.UUID, *Counter) error { return nil }
+
+func (FailingCounterProvider) Save(uuid.UUID, *Counter) error {
+	return errors.New("storage unavailable")
+}
+
+func TestQuitRemovesSessionFromIndexWhenSaveFails(t *testing.T) {
+	m := peex.New(peex.Config{Providers: []peex.ComponentProvider{
+		peex.WrapProvider[Counter](FailingCounterProvider{}),
+	}})
+	s := accept(t, m, &Counter{}, &Marker{})
+
+	s.HandleQuit()
+	if sessions := peex.SessionsWith[*Counter](m); len(sessions) != 0 {
+		t.Fatalf("%v sessions with a counter after quitting, expected none", len(sessions))
+	}
+	if sessions := peex.SessionsWith[*Marker](m); len(sessions) != 0 {
+		t.Fatalf("%v sessions with a marker after quitting, expected none", len(sessions))
+	}
+	if n := m.QueryAll(func(peex.Query[*Counter]) {}); n != 0 {
+		t.Fatalf("query ran on %v sessions after quitting, expected none", n)
+	}
+}
@@ -0,0 +1,145 @@
+package peex
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// HandlerHandle identifies a handler that was registered using Manager.RegisterHandler, which can be used to unregister
+// it again. The zero value does not identify any handler.
+type HandlerHandle struct {
+	// m is the manager that issued the handle, which is nil for the zero value.
+	m  *Manager
+	id handlerId
+}
+
+// RegisterHandler registers a handler after the manager has been created, which is useful for modules that are loaded at
+// runtime. The handler runs after every handler that was registered before it. Events that are being handled while the
+// handler is registered are not handled by it. Like New, RegisterHandler panics if a handler of the same type is
+// already registered or if the handler uses a resource that does not exist.
+func (m *Manager) RegisterHandler(h Handler) HandlerHandle {
+	m.handlersMu.Lock()
+	defer m.handlersMu.Unlock()
+
+	t := m.handlers.Load().clone()
+	id := m.addHandler(t, h)
+	m.handlers.Store(t)
+	return HandlerHandle{m: m, id: id}
+}
+
+// UnregisterHandler removes a handler that was registered using RegisterHandler. Events that are being handled while the
+// handler is removed may still be handled by it. False is returned if the handler was already unregistered, or if the
+// handle was not returned by RegisterHandler of this manager. Handlers passed in the Config can never be unregistered.
+func (m *Manager) UnregisterHandler(handle HandlerHandle) bool {
+	if handle.m != m {
+		return false
+	}
+	m.handlersMu.Lock()
+	defer m.handlersMu.Unlock()
+
+	if _, ok := m.handlers.Load().handlers[handle.id]; !ok {
+		return false
+	}
+	t := m.handlers.Load().clone()
+	t.remove(handle.id)
+	m.handlers.Store(t)
+	return true
+}
+
+/// Internal handler registry logic
+/// -------------------------------
+
+// handlerTable contains every registered handler. A table is never modified once it is in use: registering or removing
+// a handler creates a new table that replaces the old one, so events can be handled without holding any lock.
+type handlerTable struct {
+	nextId handlerId
+	ids    map[reflect.Type]handlerId
+	// handlers contains the info of every handler by its ID, and events the IDs of the handlers of every event in the
+	// order they were registered.
+	handlers map[handlerId]handlerInfo
+	events   map[eventId][]handlerId
+}
+
+// newHandlerTable creates a new table without any handlers.
+func newHandlerTable() *handlerTable {
+	return &handlerTable{
+		ids:      map[reflect.Type]handlerId{},
+		handlers: map[handlerId]handlerInfo{},
+		events:   map[eventId][]handlerId{},
+	}
+}
+
+// clone returns a copy of the table that can be modified without affecting the original.
+func (t *handlerTable) clone() *handlerTable {
+	c := &handlerTable{
+		nextId:   t.nextId,
+		ids:      make(map[reflect.Type]handlerId, len(t.ids)+1),
+		handlers: make(map[handlerId]handlerInfo, len(t.handlers)+1),
+		events:   make(map[eventId][]handlerId, len(t.events)),
+	}
+	for typ, id := range t.ids {
+		c.ids[typ] = id
+	}
+	for id, info := range t.handlers {
+		c.handlers[id] = info
+	}
+	for id, handlers := range t.events {
+		// The slices are clipped, so appending to them in the copy never modifies the original.
+		c.events[id] = slices.Clip(handlers)
+	}
+	return c
+}
+
+// remove removes the handler with the ID from the table.
+func (t *handlerTable) remove(hId handlerId) {
+	info := t.handlers[hId]
+	delete(t.ids, info.typ)
+	delete(t.handlers, hId)
+	for id := range info.events {
+		t.events[id] = slices.DeleteFunc(slices.Clone(t.events[id]), func(other handlerId) bool {
+			return other == hId
+		})
+	}
+}
+
+// addHandler adds a handler to the table, which must not be in use yet, and returns its ID.
+func (m *Manager) addHandler(t *handlerTable, h Handler) handlerId {
+	typ := reflect.TypeOf(h)
+	if _, ok := t.ids[typ]; ok {
+		panic("re-registering an existing handler type")
+	}
+	for _, info := range m.globalHandlers {
+		if info.typ == typ {
+			panic("re-registering an existing handler type")
+		}
+	}
+
+	// Assign the handler ID to the type, and generate the handlerInfo
+	hId := t.nextId
+	info := m.createHandlerInfo(h)
+	t.ids[typ] = hId
+	t.handlers[hId] = info
+	for id := range info.events {
+		t.events[id] = append(t.events[id], hId)
+	}
+
+	// Check if the handler (partially) implements a possibly outdated version of player.Handler, preventing events
+	// from being silently ignored.
+	for eventName, id := range allEvents {
+		if _, ok := info.events[id]; ok {
+			continue
+		}
+
+		// If the handler does have the method but does not implement the one specified in Peex it is probably an
+		// outdated handler method.
+		methodName := "Handle" + strings.TrimPrefix(eventName, "event")
+		if _, ok := typ.MethodByName(methodName); ok {
+			panic("incompatible handler method: " + methodName + " (is Peex or the handler outdated?)")
+		}
+	}
+
+	// Make sure to increment the handlerId for the next handler!
+	t.nextId++
+	return hId
+}
@@ -0,0 +1,127 @@
+package peex_test
+
+import (
+	"testing"
+
+	"github.com/andreashgk/peex"
+)
+
+type FirstHandler struct{ Order *[]string }
+
+func (h FirstHandler) HandleJump() { *h.Order = append(*h.Order, "first") }
+
+type LateHandler struct{ Order *[]string }
+
+func (h LateHandler) HandleJump() { *h.Order = append(*h.Order, "late") }
+
+// RegisteringHandler registers a LateHandler the first time it handles an event.
+type RegisteringHandler struct {
+	Manager *peex.Manager
+	Handle  *peex.HandlerHandle
+	Order   *[]string
+}
+
+func (h RegisteringHandler) HandleJump() {
+	*h.Order = append(*h.Order, "registering")
+	if *h.Handle == (peex.HandlerHandle{}) {
+		*h.Handle = h.Manager.RegisterHandler(LateHandler{Order: h.Order})
+	}
+}
+
+// UnregisteringHandler unregisters the handler with the handle, and stores whether that succeeded.
+type UnregisteringHandler struct {
+	Manager      *peex.Manager
+	Handle       *peex.HandlerHandle
+	Unregistered *[]bool
+}
+
+func (h UnregisteringHandler) HandleJump() {
+	*h.Unregistered = append(*h.Unregistered, h.Manager.UnregisterHandler(*h.Handle))
+}
+
+func TestRegisterHandlerDuringDispatch(t *testing.T) {
+	var order []string
+	var handle peex.HandlerHandle
+	m := peex.New(peex.Config{Handlers: []peex.Handler{RegisteringHandler{Handle: &handle, Order: &order}}})
+	s := accept(t, m)
+
+	withTimeout(t, s.HandleJump)
+	if len(order) != 1 {
+		t.Fatalf("handlers ran in order %v, expected the registered handler not to handle the current event", order)
+	}
+	withTimeout(t, s.HandleJump)
+	if len(order) != 3 || order[2] != "late" {
+		t.Fatalf("handlers ran in order %v, expected the registered handler to handle the next event", order)
+	}
+}
+
+func TestUnregisterHandlerDuringDispatch(t *testing.T) {
+	var order []string
+	var unregistered []bool
+	var handle peex.HandlerHandle
+	m := peex.New(peex.Config{Handlers: []peex.Handler{UnregisteringHandler{Handle: &handle, Unregistered: &unregistered}}})
+	handle = m.RegisterHandler(LateHandler{Order: &order})
+	s := accept(t, m)
+
+	withTimeout(t, s.HandleJump)
+	// The handler may still handle the event it was unregistered during, but no events after that.
+	handled := len(order)
+	withTimeout(t, s.HandleJump)
+	if len(order) != handled {
+		t.Fatalf("unregistered handler handled %v events after it was unregistered", len(order)-handled)
+	}
+	if len(unregistered) != 2 || !unregistered[0] || unregistered[1] {
+		t.Fatalf("unregistering returned %v, expected [true false]", unregistered)
+	}
+}
+
+func TestRegisteredHandlerRunsAfterExisting(t *testing.T) {
+	var order []string
+	m := peex.New(peex.Config{Handlers: []peex.Handler{FirstHandler{Order: &order}}})
+	m.RegisterHandler(LateHandler{Order: &order})
+	s := accept(t, m)
+
+	withTimeout(t, s.HandleJump)
+	if len(order) != 2 || order[0] != "first" || order[1] != "late" {
+		t.Fatalf("handlers ran in order %v, expected [first late]", order)
+	}
+}
+
+func TestUnregisterHandlerRejectsForeignHandles(t *testing.T) {
+	var order []string
+	m := peex.New(peex.Config{Handlers: []peex.Handler{FirstHandler{Order: &order}}})
+	other := peex.New(peex.Config{})
+	handle := other.RegisterHandler(LateHandler{Order: &order})
+	s := accept(t, m)
+
+	if m.UnregisterHandler(peex.HandlerHandle{}) {
+		t.Error("zero handle unregistered a handler")
+	}
+	if m.UnregisterHandler(handle) {
+		t.Error("handle of another manager unregistered a handler")
+	}
+	withTimeout(t, s.HandleJump)
+	if len(order) != 1 || order[0] != "first" {
+		t.Fatalf("handlers ran in order %v, expected the handler from the config to still run", order)
+	}
+}
+
+func TestRegisterDuplicateHandlerPanics(t *testing.T) {
+	m := peex.New(peex.Config{Handlers: []peex.Handler{FirstHandler{}}})
+	handle := m.RegisterHandler(LateHandler{})
+
+	for name, h := range map[string]peex.Handler{"config": FirstHandler{}, "registered": LateHandler{}} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("registering a handler of an existing type did not panic")
+				}
+			}()
+			m.RegisterHandler(h)
+		})
+	}
+
+	// The type can be registered again once the handler was unregistered.
+	m.UnregisterHandler(handle)
+	m.RegisterHandler(LateHandler{})
+}
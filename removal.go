@@ -0,0 +1,94 @@
+package peex
+
+import (
+	"fmt"
+	"slices"
+)
+
+// RemovedOn represents a Component that is removed from a Session automatically when the player handles certain events,
+// such as a combat tag that is removed when the player dies. The component is removed through the normal path after all
+// handlers have handled the event, so the Remove method is called and the component is saved if it has a provider.
+type RemovedOn interface {
+	Component
+	// RemoveOn returns the names of the events after which the component is removed, such as "Death" for HandleDeath or
+	// "ChangeWorld" for HandleChangeWorld. Custom events can be used by the name of their type, as long as a handler of
+	// the event was registered before. It is only called once per component type, when the first component of the type
+	// is added, so it must return the same events for every instance of the type. Adding the component panics if one of
+	// the events does not exist.
+	RemoveOn() []string
+}
+
+/// Internal removal logic
+/// ----------------------
+
+// registerRemoval registers the events after which components of the type with the ID are removed, if this has not been
+// done before for the type.
+func (m *Manager) registerRemoval(cId componentId, r RemovedOn) {
+	m.removalMu.RLock()
+	_, ok := m.removalTypes[cId]
+	m.removalMu.RUnlock()
+	if ok {
+		return
+	}
+
+	// Look up all the events before registering any of them, so that nothing is registered if one does not exist.
+	var ids []eventId
+	for _, name := range r.RemoveOn() {
+		eventIds := eventIdsByName(name)
+		if len(eventIds) == 0 {
+			panic(fmt.Errorf("component %v is removed on unknown event %q", m.componentName(cId), name))
+		}
+		ids = append(ids, eventIds...)
+	}
+
+	m.removalMu.Lock()
+	defer m.removalMu.Unlock()
+	// The type might have been registered by another goroutine in the meantime.
+	if _, ok := m.removalTypes[cId]; ok {
+		return
+	}
+	m.removalTypes[cId] = struct{}{}
+	for _, id := range ids {
+		// The slice may be read by sessions without holding the lock, so a new one is created instead of appending to it.
+		m.removedBy[id] = append(slices.Clip(m.removedBy[id]), cId)
+	}
+}
+
+// eventIdsByName returns the IDs of the events with the name, which is the name of the handler method without the
+// Handle prefix. Multiple custom event types may have the same name, in which case the IDs of all of them are returned.
+func eventIdsByName(name string) []eventId {
+	if id, ok := allEvents["event"+name]; ok {
+		return []eventId{id}
+	}
+	customMu.RLock()
+	defer customMu.RUnlock()
+	var ids []eventId
+	for id, customName := range customEventNames {
+		if customName == name {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// removeOnEvent removes the components that must be removed after the event. This must be called after the event has
+// been handled, when the components lock is no longer held.
+func (s *Session) removeOnEvent(eventId eventId) {
+	s.m.removalMu.RLock()
+	cIds := s.m.removedBy[eventId]
+	s.m.removalMu.RUnlock()
+	if len(cIds) == 0 {
+		return
+	}
+
+	defer s.lock()()
+	for _, cId := range cIds {
+		c, ok := s.components[cId]
+		if !ok {
+			continue
+		}
+		if _, err := s.removeComponent(cId, c); err != nil {
+			s.log.Error("error removing component after event", "component", s.m.componentName(cId), "event", eventName(eventId), "err", err)
+		}
+	}
+}
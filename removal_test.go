@@ -0,0 +1,134 @@
+package peex_test
+
+import (
+	"testing"
+
+	"github.com/andreashgk/peex"
+	"github.com/df-mc/dragonfly/server/event"
+)
+
+// JumpTag is removed after its player jumps.
+type JumpTag struct{}
+
+func (JumpTag) RemoveOn() []string { return []string{"Jump"} }
+
+// RoundTag is removed after the RoundEnd custom event.
+type RoundTag struct{}
+
+func (RoundTag) RemoveOn() []string { return []string{"RoundEnd"} }
+
+// TypoTag is removed on an event that does not exist.
+type TypoTag struct{}
+
+func (TypoTag) RemoveOn() []string { return []string{"Jump", "Jupm"} }
+
+type RoundEnd struct{}
+
+// JumpTagHandler records whether the session still had its JumpTag when it handled the jump, and optionally panics.
+type JumpTagHandler struct {
+	Tag   peex.Option[JumpTag]
+	Seen  *[]bool
+	Panic bool
+}
+
+func (h JumpTagHandler) HandleJump() {
+	_, ok := h.Tag.Load()
+	*h.Seen = append(*h.Seen, ok)
+	if h.Panic {
+		panic("jump handler panicked")
+	}
+}
+
+// SecondJumpTagHandler works the same as JumpTagHandler, but is a separate type so that both can be registered.
+type SecondJumpTagHandler JumpTagHandler
+
+func (h SecondJumpTagHandler) HandleJump() { JumpTagHandler(h).HandleJump() }
+
+type RoundEndHandler struct {
+	Tag peex.Query[RoundTag]
+}
+
+func (RoundEndHandler) HandleRoundEnd(*event.Context, RoundEnd) {}
+
+func hasComponent(s *peex.Session, c peex.Component) bool {
+	_, ok := s.Component(c)
+	return ok
+}
+
+func TestRemovedAfterAllHandlers(t *testing.T) {
+	var seen []bool
+	m := peex.New(peex.Config{Handlers: []peex.Handler{
+		JumpTagHandler{Seen: &seen},
+		SecondJumpTagHandler{Seen: &seen},
+	}})
+	s := accept(t, m, JumpTag{})
+
+	withTimeout(t, s.HandleJump)
+	if len(seen) != 2 || !seen[0] || !seen[1] {
+		t.Fatalf("handlers saw the tag %v, expected both to see it", seen)
+	}
+	if hasComponent(s, JumpTag{}) {
+		t.Fatal("tag was not removed after the event")
+	}
+}
+
+func TestRemovedWhenHandlerPanics(t *testing.T) {
+	var seen []bool
+	m := peex.New(peex.Config{Handlers: []peex.Handler{JumpTagHandler{Seen: &seen, Panic: true}}})
+	s := accept(t, m, JumpTag{})
+
+	withTimeout(t, func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("handler did not panic")
+			}
+		}()
+		s.HandleJump()
+	})
+	if hasComponent(s, JumpTag{}) {
+		t.Fatal("tag was not removed after the handler panicked")
+	}
+}
+
+func TestRemovedOnCustomEvent(t *testing.T) {
+	m := peex.New(peex.Config{Handlers: []peex.Handler{RoundEndHandler{}}})
+	s := accept(t, m, RoundTag{})
+
+	withTimeout(t, func() { peex.Emit(s, RoundEnd{}) })
+	if hasComponent(s, RoundTag{}) {
+		t.Fatal("tag was not removed after the custom event")
+	}
+}
+
+func TestRemovedOnUnknownEventPanics(t *testing.T) {
+	m := peex.New(peex.Config{})
+	s := accept(t, m)
+
+	for name, insert := range map[string]func() error{
+		"InsertComponent": func() error { return s.InsertComponent(TypoTag{}) },
+		"SetComponent": func() error {
+			s.SetComponent(TypoTag{})
+			return nil
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			withTimeout(t, func() {
+				defer func() {
+					if recover() == nil {
+						t.Error("adding a component removed on an unknown event did not panic")
+					}
+				}()
+				_ = insert()
+			})
+			if hasComponent(s, TypoTag{}) {
+				t.Fatal("component was added even though it panicked")
+			}
+		})
+	}
+	// The session must not have been left locked.
+	withTimeout(t, func() {
+		if err := s.InsertComponent(&Counter{}); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package peex
+
+import (
+	"fmt"
+	"github.com/df-mc/atomic"
+	"reflect"
+)
+
+// Res is used to inject a resource into a handler or query function. Resources are values shared by the whole manager,
+// such as a database or an arena registry, which are passed in the Resources field of the Config. A Res field is set to
+// the resource with the type T, or to the only resource that implements T if T is an interface. Unlike copied fields,
+// resources also work for handlers that are not pointers, and can be replaced at runtime using Manager.SetResource.
+type Res[T any] struct {
+	val T
+}
+
+// Load returns the resource.
+func (r Res[T]) Load() T {
+	return r.val
+}
+
+// Resource returns the resource of type T, along with whether it exists. If T is an interface, the resource that
+// implements it is returned. Resource panics if multiple resources implement T.
+func Resource[T any](m *Manager) (T, bool) {
+	res, ok := m.lookupResource(reflect.TypeOf((*T)(nil)).Elem())
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return res.v.Load().(T), true
+}
+
+// SetResource replaces the resource with the same type as the argument. Handlers and query functions receive the new
+// resource from then on, while handlers that are currently running keep the old one. If there is no resource of this
+// type yet, it is added, after which it can be used by query functions. Handlers must be able to find all their
+// resources when the manager is created, however.
+// A resource is never replaced by a value of another type, even if both implement the same interface. SetResource panics
+// if it would add a resource that implements an interface a resource has already been looked up by, as that interface
+// would then no longer identify a single resource.
+func (m *Manager) SetResource(v any) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		panic("cannot provide nil as a resource")
+	}
+
+	m.resourcesMu.Lock()
+	defer m.resourcesMu.Unlock()
+	if res, ok := m.resources[t]; ok {
+		res.v.Store(v)
+		return
+	}
+	for it := range m.resourceInterfaces {
+		if t.Implements(it) {
+			panic(fmt.Errorf("cannot add resource of type %v, as another resource is already used as %v", t, it))
+		}
+	}
+	m.resources[t] = &resource{v: atomic.NewValue[any](v)}
+	m.resourceTypes = append(m.resourceTypes, t)
+}
+
+/// Internal resource logic
+/// -----------------------
+
+// resource holds the current value of a resource, which may be replaced at any time.
+type resource struct {
+	v *atomic.Value[any]
+}
+
+// resourceField is a handler field that a resource is injected into.
+type resourceField struct {
+	fieldNum int
+	res      *resource
+}
+
+// resourceType is the interface implemented by every type of Res.
+type resourceType interface {
+	// resourceType returns the type of the resource.
+	resourceType() reflect.Type
+	// setResource returns a copy of the Res holding the value.
+	setResource(v any) resourceType
+}
+
+func (r Res[T]) resourceType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func (r Res[T]) setResource(v any) resourceType {
+	r.val = v.(T)
+	return r
+}
+
+// lookupResource returns the resource with the type. For interface types the resource implementing the interface is
+// returned, and the interface is remembered so that no other resource implementing it can be added later. It panics if
+// multiple resources implement the interface.
+func (m *Manager) lookupResource(t reflect.Type) (*resource, bool) {
+	m.resourcesMu.RLock()
+	res, ok := m.resources[t]
+	m.resourcesMu.RUnlock()
+	if ok || t.Kind() != reflect.Interface {
+		return res, ok
+	}
+
+	m.resourcesMu.Lock()
+	defer m.resourcesMu.Unlock()
+	var match reflect.Type
+	for _, rt := range m.resourceTypes {
+		if !rt.Implements(t) {
+			continue
+		}
+		if match != nil {
+			panic(fmt.Errorf("multiple resources implement %v (%v and %v)", t, match, rt))
+		}
+		match = rt
+	}
+	if match == nil {
+		return nil, false
+	}
+	m.resourceInterfaces[t] = struct{}{}
+	return m.resources[match], true
+}
+
+// mustResource returns the resource with the type, or panics if there is none. What the resource is needed for is
+// included in the panic.
+func (m *Manager) mustResource(t reflect.Type, usedBy string) *resource {
+	res, ok := m.lookupResource(t)
+	if !ok {
+		panic(fmt.Errorf("missing resource %v for %v", t, usedBy))
+	}
+	return res
+}
@@ -0,0 +1,150 @@
+package peex_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/andreashgk/peex"
+)
+
+type Store interface {
+	Name() string
+}
+
+type MemoryStore struct{ name string }
+
+func (s *MemoryStore) Name() string { return s.name }
+
+type FileStore struct{}
+
+func (*FileStore) Name() string { return "file" }
+
+// StoreHandler records the name of the Store resource every time its player jumps.
+type StoreHandler struct {
+	Store peex.Res[Store]
+	Names *[]string
+}
+
+func (h StoreHandler) HandleJump() {
+	*h.Names = append(*h.Names, h.Store.Load().Name())
+}
+
+func TestResourceInHandler(t *testing.T) {
+	var names []string
+	m := peex.New(peex.Config{
+		Handlers:  []peex.Handler{StoreHandler{Names: &names}},
+		Resources: []any{&MemoryStore{name: "a"}},
+	})
+	s := accept(t, m)
+
+	withTimeout(t, s.HandleJump)
+	m.SetResource(&MemoryStore{name: "b"})
+	withTimeout(t, s.HandleJump)
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Fatalf("handler saw resources %v, expected [a b]", names)
+	}
+}
+
+func TestResourceInQuery(t *testing.T) {
+	m := peex.New(peex.Config{Resources: []any{&MemoryStore{name: "a"}}})
+	s := accept(t, m, &Counter{})
+
+	var name string
+	withTimeout(t, func() {
+		s.Query(func(store peex.Res[*MemoryStore], c peex.Query[*Counter]) {
+			name = store.Load().Name()
+		})
+	})
+	if name != "a" {
+		t.Fatalf("query saw resource %q, expected a", name)
+	}
+	if store, ok := peex.Resource[Store](m); !ok || store.Name() != "a" {
+		t.Fatalf("Resource returned %v, %v, expected the store", store, ok)
+	}
+	if _, ok := peex.Resource[*FileStore](m); ok {
+		t.Fatal("Resource found a resource that was not provided")
+	}
+}
+
+func TestMissingResourcePanics(t *testing.T) {
+	tests := map[string]func(){
+		"handler": func() {
+			peex.New(peex.Config{Handlers: []peex.Handler{StoreHandler{}}})
+		},
+		"query": func() {
+			m := peex.New(peex.Config{})
+			s := accept(t, m)
+			s.Query(func(peex.Res[*MemoryStore]) {})
+		},
+	}
+	for name, f := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("using a missing resource did not panic")
+				}
+			}()
+			f()
+		})
+	}
+}
+
+func TestAmbiguousResourcePanics(t *testing.T) {
+	tests := map[string]func(){
+		"config": func() {
+			peex.New(peex.Config{
+				Handlers:  []peex.Handler{StoreHandler{}},
+				Resources: []any{&MemoryStore{}, &FileStore{}},
+			})
+		},
+		"SetResource": func() {
+			m := peex.New(peex.Config{
+				Handlers:  []peex.Handler{StoreHandler{}},
+				Resources: []any{&MemoryStore{}},
+			})
+			m.SetResource(&FileStore{})
+		},
+	}
+	for name, f := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("adding a second resource implementing the interface did not panic")
+				}
+			}()
+			f()
+		})
+	}
+}
+
+func TestSetResourceConcurrently(t *testing.T) {
+	var names []string
+	m := peex.New(peex.Config{
+		Handlers:  []peex.Handler{StoreHandler{Names: &names}},
+		Resources: []any{&MemoryStore{name: "a"}},
+	})
+	s := accept(t, m)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.SetResource(&MemoryStore{name: "b"})
+				if store, ok := peex.Resource[*MemoryStore](m); !ok || store == nil {
+					t.Error("resource disappeared while it was being replaced")
+				}
+			}
+		}()
+	}
+	withTimeout(t, func() {
+		for i := 0; i < 100; i++ {
+			s.HandleJump()
+		}
+	})
+	wg.Wait()
+	if len(names) != 100 {
+		t.Fatalf("handler ran %v times, expected 100", len(names))
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"github.com/df-mc/atomic"
 	"github.com/df-mc/dragonfly/server/player"
+	"github.com/google/uuid"
+	"log/slog"
 	"reflect"
 	"sync"
+	"time"
 )
 
 //go:generate go run ./cmd/events/main.go -o events.go -p peex -m ./go.mod
@@ -15,11 +18,30 @@ var _ player.Handler = (*Session)(nil)
 // Session is a unique object that stores a player's data and handles player events. Data is stored in components, which
 // can be added and removed from the Session at any time.
 type Session struct {
-	p atomic.Value[*player.Player]
-	m *Manager
+	p   atomic.Value[*player.Player]
+	m   *Manager
+	id  uuid.UUID
+	log *slog.Logger
 
 	components   map[componentId]Component
-	componentsMu sync.RWMutex
+	componentsMu sessionLock
+	// componentsMapMu protects the map of components, which is only changed while the components lock is held for
+	// writing. Looking up a component only requires this lock, so it can be done while the session is locked by a handler.
+	componentsMapMu sync.RWMutex
+
+	// interfaces caches which component is used for queries on an interface type, by the ID of the interface type.
+	interfaces   map[componentId]interfaceMatch
+	interfacesMu sync.Mutex
+
+	// expiries contains the scheduled removals of components, which are protected by the components lock.
+	expiries map[componentId]*expiry
+
+	// disabledGroups contains the bits of the handler groups that are disabled for the session.
+	disabledGroups atomic.Uint64
+
+	// detached is true for sessions created by Manager.Observe. These have no components, are not stored in the manager
+	// and only run global handlers.
+	detached bool
 }
 
 // Player returns the Player that owns the Session. Returns nil if the Session is owned by a player that is no longer
@@ -41,20 +63,28 @@ func (s *Session) SaveAll() error {
 	var e error
 	uuid := s.Player().UUID()
 
-	s.componentsMu.RLock()
+	unlock := s.rlock()
 	for id, p := range s.m.componentProvs {
 		c, ok := s.components[id]
 		if !ok {
 			continue
 		}
-		err := p.save(uuid, c)
+		err := s.m.saveComponent(p, id, uuid, c)
 		// If there was an error saving the component, save it, so it can be returned. Will overwrite previous errors.
 		// Do not automatically return on error, as we want to minimize any data loss.
 		if err != nil {
 			e = err
 		}
 	}
-	s.componentsMu.RUnlock()
+	for id, p := range s.m.keyedProvs {
+		set, _ := s.components[id].(keyedSet)
+		for key, c := range set {
+			if err := s.m.saveKeyed(p, id, uuid, key, c); err != nil {
+				e = err
+			}
+		}
+	}
+	unlock()
 
 	if e != nil {
 		return fmt.Errorf("error while saving component: %w", e)
@@ -65,8 +95,7 @@ func (s *Session) SaveAll() error {
 // Save saves a single component type for the session. Saves the component of the same type as the argument that is
 // currently present as opposed to the one provided as argument.
 func (s *Session) Save(c Component) error {
-	s.componentsMu.RLock()
-	defer s.componentsMu.RUnlock()
+	defer s.rlock()()
 
 	cId := s.m.getComponentId(c)
 	c, ok := s.components[cId]
@@ -78,7 +107,7 @@ func (s *Session) Save(c Component) error {
 		return errors.New("trying to save a component without a provider")
 	}
 
-	err := p.save(s.Player().UUID(), c)
+	err := s.m.saveComponent(p, cId, s.Player().UUID(), c)
 	if err != nil {
 		return fmt.Errorf("error while saving component: %w", err)
 	}
@@ -90,9 +119,8 @@ func (s *Session) Save(c Component) error {
 func (s *Session) InsertComponent(c Component) error {
 	cId := s.m.getComponentId(c)
 
-	s.componentsMu.Lock()
-	defer s.componentsMu.Unlock()
-	return s.insertComponent(cId, c)
+	defer s.lock()()
+	return s.insertComponent(cId, c, 0)
 	// todo: recalculate handlers here?
 }
 
@@ -104,7 +132,10 @@ func (s *Session) InsertComponent(c Component) error {
 // NOTE: does NOT load the component!
 func (s *Session) SetComponent(c Component) {
 	cId := s.m.getComponentId(c)
-	s.componentsMu.Lock()
+	if r, ok := c.(RemovedOn); ok {
+		s.m.registerRemoval(cId, r)
+	}
+	unlock := s.lock()
 
 	p := s.Player()
 	// If the component is already present, first call Remove() on the previous component if it implements it.
@@ -112,26 +143,35 @@ func (s *Session) SetComponent(c Component) {
 		if r, ok := prev.(Remover); ok {
 			r.Remove(p)
 		}
+	} else {
+		s.componentsChanged()
+		s.m.indexAdd(cId, s)
+		if s.m.metrics != nil {
+			s.m.metrics.AddComponents(s.m.componentName(cId), 1)
+		}
 	}
 
-	s.components[cId] = c
+	s.storeComponent(cId, c)
+	// A removal scheduled for the previous component does not apply to the new one.
+	s.cancelRemoval(cId)
+	s.scheduleExpiry(cId, c)
 	if a, ok := c.(Adder); ok {
 		a.Add(p)
 	}
 	// todo: recalculate handlers here?
-	s.componentsMu.Unlock()
+	unlock()
 }
 
 // Component returns the Component in the Session of the same type as the argument if it was found.
 func (s *Session) Component(c Component) (Component, bool) {
-	cId, ok := s.m.componentIdTable[reflect.TypeOf(c)] // we don't need to create a component id here
+	cId, ok := s.m.lookupComponentId(reflect.TypeOf(c)) // we don't need to create a component id here
 	if !ok {
 		return nil, false
 	}
 
-	s.componentsMu.RLock()
+	s.componentsMapMu.RLock()
 	comp, ok := s.components[cId]
-	s.componentsMu.RUnlock()
+	s.componentsMapMu.RUnlock()
 	return comp, ok
 }
 
@@ -139,13 +179,12 @@ func (s *Session) Component(c Component) (Component, bool) {
 // of the component will also be returned, If the Session does not have the component, nothing happens, and nil is
 // returned. Also saves the component if a provider for it has been set in the config.
 func (s *Session) RemoveComponent(c Component) (Component, error) {
-	cId, ok := s.m.componentIdTable[reflect.TypeOf(c)]
+	cId, ok := s.m.lookupComponentId(reflect.TypeOf(c))
 	if !ok {
 		return nil, errors.New("trying to remove unknown component")
 	}
 
-	s.componentsMu.Lock()
-	defer s.componentsMu.Unlock()
+	defer s.lock()()
 	return s.removeComponent(cId, c)
 }
 
@@ -154,16 +193,46 @@ func (s *Session) RemoveComponent(c Component) (Component, error) {
 
 // query executes a query function on the session (if it has all the required components).
 func (s *Session) query(queryFunc any, info queryFuncInfo) bool {
-	val := reflect.ValueOf(queryFunc)
-	args := make([]reflect.Value, 0, len(info.params))
+	tx := &Tx{}
+	ran := func() bool {
+		s.acquire(info.mutable)
+		defer s.release(info.mutable)
 
-	s.componentsMu.RLock()
-	defer s.componentsMu.RUnlock()
-	for _, param := range info.params {
-		c, ok := s.components[param.cId]
-		if !ok && !param.optional {
+		args, writes, ok := s.queryArgs(info.params, tx)
+		if !ok {
 			return false
+		}
+		reflect.ValueOf(queryFunc).Call(args)
+		applyWrites(writes)
+		return true
+	}()
+	if err := tx.apply(); err != nil {
+		s.log.Error("error applying query transaction", "err", err)
+	}
+	return ran
+}
+
+// queryArgs creates the arguments for a query function from the session's components, along with the writes that must
+// be applied once the function returns. False is returned if a required component is missing. The components lock must
+// be held while calling this method.
+func (s *Session) queryArgs(params []queryFuncParam, tx *Tx) ([]reflect.Value, []pendingWrite, bool) {
+	args := make([]reflect.Value, 0, len(params))
+	var writes []pendingWrite
+	for _, param := range params {
+		if param.tx {
+			args = append(args, reflect.ValueOf(tx))
+			continue
+		}
+		if param.res != nil {
+			args = append(args, param.resource())
+			continue
+		}
+
+		cId, c, ok := s.queryComponent(param.cId)
+		if !ok && !param.optional {
+			return nil, nil, false
 		} else if !ok && param.optional {
+			args = append(args, reflect.ValueOf(param.query))
 			continue
 		}
 
@@ -171,30 +240,52 @@ func (s *Session) query(queryFunc any, info queryFuncInfo) bool {
 			args = append(args, reflect.ValueOf(c))
 			continue
 		}
-		args = append(args, reflect.ValueOf(param.query.set(c)))
+		q := param.query.set(c)
+		writes = trackWrite(writes, s, cId, q)
+		args = append(args, reflect.ValueOf(q))
 	}
-
-	val.Call(args)
-	return true
+	return args, writes, true
 }
 
-// insertComponent adds a component to the session. This method is not safe for use in multiple goroutines.
-func (s *Session) insertComponent(cId componentId, c Component) error {
+// insertComponent adds a component to the session. If d is more than zero, the component is removed again once it has
+// passed. This method is not safe for use in multiple goroutines.
+func (s *Session) insertComponent(cId componentId, c Component, d time.Duration) error {
+	// The events the component is removed on are registered first, as this panics if one of them does not exist.
+	if r, ok := c.(RemovedOn); ok {
+		s.m.registerRemoval(cId, r)
+	}
 	if _, ok := s.components[cId]; ok {
 		return errors.New("session already has a component of this type")
 	}
 
 	// Try to load the component if it has a provider.
 	if p, ok := s.m.componentProvs[cId]; ok {
-		err := p.load(s.Player().UUID(), c)
+		err := s.m.loadComponent(p, cId, s.Player().UUID(), c)
 		if err != nil {
 			return fmt.Errorf("error while loading component: %w", err)
 		}
 	}
-	s.components[cId] = c
+	// The expiry is set after loading, so that it replaces any expiry the component was saved with, but before the
+	// component is added, so that Adder sees it.
+	if d > 0 {
+		if e, ok := c.(Expires); ok {
+			e.SetExpiry(time.Now().Add(d))
+		}
+	}
+	s.storeComponent(cId, c)
+	s.componentsChanged()
+	s.m.indexAdd(cId, s)
+	if d > 0 {
+		s.scheduleRemoval(cId, d)
+	} else {
+		s.scheduleExpiry(cId, c)
+	}
 	if a, ok := c.(Adder); ok {
 		a.Add(s.Player())
 	}
+	if s.m.metrics != nil {
+		s.m.metrics.AddComponents(s.m.componentName(cId), 1)
+	}
 	return nil
 }
 
@@ -210,26 +301,52 @@ func (s *Session) removeComponent(cId componentId, c Component) (Component, erro
 	}
 	// Try to save the component
 	if p, ok := s.m.componentProvs[cId]; ok {
-		err := p.save(s.Player().UUID(), c)
+		err := s.m.saveComponent(p, cId, s.Player().UUID(), c)
 		if err != nil {
 			return nil, fmt.Errorf("error while saving component: %w", err)
 		}
 	}
-	delete(s.components, cId)
+	s.deleteComponent(cId)
+	s.componentsChanged()
+	s.m.indexRemove(cId, s)
+	s.cancelRemoval(cId)
+	if s.m.metrics != nil {
+		s.m.metrics.AddComponents(s.m.componentName(cId), -1)
+	}
 	// todo: recalculate handlers here?
 	return c, nil
 }
 
 func (s *Session) doQuit() {
-	s.componentsMu.Lock()
-	defer s.componentsMu.Unlock()
+	if s.detached {
+		s.p.Store(nil)
+		return
+	}
+
+	defer s.lock()()
 
-	for _, comp := range s.components {
-		_, err := s.removeComponent(s.m.getComponentId(comp), comp)
-		if err != nil && s.m.logger != nil {
-			s.m.logger.Errorf("%w", err)
+	for cId, comp := range s.components {
+		if set, ok := comp.(keyedSet); ok {
+			for key := range set {
+				if _, err := s.removeKeyed(cId, key); err != nil {
+					s.log.Error("error removing keyed component while quitting", "component", s.m.keyedName(cId), "key", key, "err", err)
+				}
+			}
+			continue
+		}
+		_, err := s.removeComponent(cId, comp)
+		if err != nil {
+			s.log.Error("error removing component while quitting", "component", s.m.componentName(cId), "err", err)
 		}
 	}
+	// Components that could not be removed are still in the index, and may still have a removal scheduled. The session is
+	// removed from the manager regardless, so it must not be found through the index anymore either.
+	for cId := range s.components {
+		s.m.indexRemove(cId, s)
+	}
+	for cId := range s.expiries {
+		s.cancelRemoval(cId)
+	}
 
 	var p *player.Player
 	// A nil player means the session is offline
@@ -239,6 +356,11 @@ func (s *Session) doQuit() {
 
 	s.m.sessionMu.Lock()
 	delete(s.m.sessions, p.UUID())
+	if s.m.metrics != nil {
+		s.m.metrics.SetSessions(len(s.m.sessions))
+	}
 	s.m.sessionMu.Unlock()
+	s.componentsMapMu.Lock()
 	s.components = nil
+	s.componentsMapMu.Unlock()
 }
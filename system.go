@@ -0,0 +1,149 @@
+package peex
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+)
+
+// System is a struct that runs logic periodically for every Session that matches its queries, such as regeneration or
+// refreshing scoreboards. Like a Handler, a system can have query fields and fields for the player, session, manager,
+// logger and errors, which are set for every session it runs on. Target fields cannot be used, as a system does not run
+// for an event. Systems are passed in the Config and run in the order they were provided every time the Manager ticks.
+type System interface {
+	// Tick is called for every session that matches the queries of the system, with the time that passed since the
+	// system last ran.
+	Tick(dt time.Duration)
+}
+
+// IntervalSystem is a System that only runs once every interval, instead of every time the Manager ticks.
+type IntervalSystem interface {
+	System
+	// Interval returns the minimum time between two runs of the system.
+	Interval() time.Duration
+}
+
+// Tick runs every system that is due for every session that matches its queries. The duration is the time that passed
+// since the last tick. Tick can be called from a world tick hook or a custom loop, or RunSystems can be used instead.
+// A panic in a system is recovered and logged, after which the system continues with the next session. Systems that
+// panic too often are disabled in the same way as handlers.
+func (m *Manager) Tick(dt time.Duration) {
+	m.tickMu.Lock()
+	defer m.tickMu.Unlock()
+
+	for _, sys := range m.systems {
+		if sys.info.state.disabled.Load() || sys.info.groups&m.disabledGroups.Load() != 0 {
+			continue
+		}
+		sys.elapsed += dt
+		if sys.elapsed < sys.interval {
+			continue
+		}
+		elapsed := sys.elapsed
+		sys.elapsed = 0
+
+		m.sessionMu.RLock()
+		sessions := m.indexedSessions(sys.required)
+		m.sessionMu.RUnlock()
+		sortSessions(sessions)
+		for _, s := range sessions {
+			s.tickSystem(sys.info, elapsed)
+		}
+	}
+}
+
+// RunSystems ticks the Manager at a fixed rate until the context is cancelled. It blocks while doing so, and should
+// usually be run in its own goroutine.
+func (m *Manager) RunSystems(ctx context.Context, rate time.Duration) {
+	t := time.NewTicker(rate)
+	defer t.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			m.Tick(now.Sub(last))
+			last = now
+		}
+	}
+}
+
+/// Internal system logic
+/// ---------------------
+
+// eventTick is used in place of an event ID for systems, so that they can be reported in the same way as handlers.
+const eventTick = ^eventId(0)
+
+// systemInfo contains data about a system and when it runs.
+type systemInfo struct {
+	info     handlerInfo
+	interval time.Duration
+	// required contains the components that must be present for the system to run, which are used to find the
+	// sessions it may run on.
+	required []componentId
+	// elapsed is the time that passed since the system last ran.
+	elapsed time.Duration
+}
+
+// createSystemInfo creates a new system info struct for a system. It panics if the system has Target fields, as systems
+// do not run for an event and therefore never have a target.
+func (m *Manager) createSystemInfo(sys System) *systemInfo {
+	info := m.createHandlerInfo(sys)
+	if len(info.targets) > 0 {
+		panic("systems cannot have Target fields (" + info.name + ")")
+	}
+	si := &systemInfo{info: info}
+	if i, ok := sys.(IntervalSystem); ok {
+		si.interval = i.Interval()
+	}
+	for _, q := range info.components {
+		if !q.optional {
+			si.required = append(si.required, q.id)
+		}
+	}
+	return si
+}
+
+// tickSystem runs the system on the session if it matches its queries.
+func (s *Session) tickSystem(info handlerInfo, dt time.Duration) {
+	// Panics are always recovered for systems, so that a panic does not prevent the system from running on other
+	// sessions. If panics are recovered for handlers, this is already done by runHandler.
+	defer func() {
+		if r := recover(); r != nil {
+			s.m.handlerPanicked(s, eventTick, info, r, debug.Stack())
+		}
+	}()
+
+	// The error handler is only called once the session is unlocked again, so that it can freely change its components.
+	if report := s.lockAndTickSystem(info, dt); report != nil {
+		s.m.handleErrors(s, eventTick, info, report)
+	}
+}
+
+// lockAndTickSystem runs the system on the session while it is locked if it matches its queries, and returns the errors
+// reported by the system.
+func (s *Session) lockAndTickSystem(info handlerInfo, dt time.Duration) *errorReport {
+	s.acquire(info.mutable)
+	defer s.release(info.mutable)
+	// The session may have quit since the sessions were collected.
+	if s.components == nil {
+		return nil
+	}
+	if info.groups&s.disabledGroups.Load() != 0 {
+		return nil
+	}
+	comps, ok := s.matchHandler(info, nil)
+	if !ok {
+		return nil
+	}
+
+	d := &Dispatch{s: s, info: &info}
+	sys := s.buildHandler(d, comps).(System)
+	s.runHandler(context.Background(), eventTick, info, func() {
+		sys.Tick(dt)
+	})
+	applyWrites(d.writes)
+	return d.report
+}
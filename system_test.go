@@ -0,0 +1,128 @@
+package peex_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andreashgk/peex"
+)
+
+type Score int
+
+// ScoreSystem increases the Score of every session by one every tick.
+type ScoreSystem struct {
+	Score peex.Mut[Score]
+}
+
+func (s ScoreSystem) Tick(time.Duration) {
+	s.Score.Update(func(v *Score) { *v++ })
+}
+
+// SlowScoreSystem increases the Score of every session by the seconds that passed, but only runs once per second.
+type SlowScoreSystem struct {
+	Score peex.Mut[Score]
+}
+
+func (s SlowScoreSystem) Tick(dt time.Duration) {
+	s.Score.Update(func(v *Score) { *v += Score(dt.Seconds()) })
+}
+
+func (SlowScoreSystem) Interval() time.Duration { return time.Second }
+
+type TargetSystem struct {
+	Victim peex.Target[peex.Query[*Team]]
+}
+
+func (TargetSystem) Tick(time.Duration) {}
+
+func score(t *testing.T, s *peex.Session) Score {
+	t.Helper()
+	c, ok := s.Component(Score(0))
+	if !ok {
+		t.Fatal("session has no score")
+	}
+	return c.(Score)
+}
+
+func TestTickWritesBack(t *testing.T) {
+	m := peex.New(peex.Config{Systems: []peex.System{ScoreSystem{}}})
+	s := accept(t, m, Score(0))
+	without := accept(t, m)
+
+	for i := 0; i < 3; i++ {
+		withTimeout(t, func() { m.Tick(time.Second / 20) })
+	}
+	if got := score(t, s); got != 3 {
+		t.Fatalf("score is %v, expected 3", got)
+	}
+	if _, ok := without.Component(Score(0)); ok {
+		t.Fatal("system added a component to a session without one")
+	}
+}
+
+func TestIntervalSystem(t *testing.T) {
+	m := peex.New(peex.Config{Systems: []peex.System{SlowScoreSystem{}}})
+	s := accept(t, m, Score(0))
+
+	for i := 0; i < 30; i++ {
+		m.Tick(time.Second / 20)
+	}
+	// The system ran once after 20 ticks, with the time that passed since it last ran.
+	if got := score(t, s); got != 1 {
+		t.Fatalf("score is %v, expected 1", got)
+	}
+}
+
+func TestRunSystems(t *testing.T) {
+	m := peex.New(peex.Config{Systems: []peex.System{ScoreSystem{}}})
+	s := accept(t, m, Score(0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.RunSystems(ctx, time.Millisecond)
+	}()
+	eventually(t, func() bool {
+		var got Score
+		s.Query(func(v peex.Query[Score]) { got = v.Load() })
+		return got >= 3
+	})
+	cancel()
+	withTimeout(t, func() { <-done })
+}
+
+func TestSystemGroups(t *testing.T) {
+	m := peex.New(peex.Config{
+		Systems: []peex.System{ScoreSystem{}},
+		Groups:  map[string][]peex.Handler{"score": {ScoreSystem{}}},
+	})
+	a, b := accept(t, m, Score(0)), accept(t, m, Score(0))
+
+	mustGroup(t, b.DisableGroup("score"))
+	m.Tick(time.Second / 20)
+	if score(t, a) != 1 || score(t, b) != 0 {
+		t.Fatalf("scores are %v and %v, expected 1 and 0 with the group disabled for the second session", score(t, a), score(t, b))
+	}
+	mustGroup(t, m.SetGroupEnabled("score", false))
+	mustGroup(t, b.EnableGroup("score"))
+	m.Tick(time.Second / 20)
+	if score(t, a) != 1 || score(t, b) != 0 {
+		t.Fatalf("scores are %v and %v, expected no changes with the group disabled", score(t, a), score(t, b))
+	}
+	mustGroup(t, m.SetGroupEnabled("score", true))
+	m.Tick(time.Second / 20)
+	if score(t, a) != 2 || score(t, b) != 1 {
+		t.Fatalf("scores are %v and %v, expected 2 and 1 with the group enabled", score(t, a), score(t, b))
+	}
+}
+
+func TestSystemWithTargetPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("creating a manager with a Target system did not panic")
+		}
+	}()
+	peex.New(peex.Config{Systems: []peex.System{TargetSystem{}}})
+}
@@ -0,0 +1,67 @@
+package peex_test
+
+import (
+	"testing"
+
+	"github.com/andreashgk/peex"
+	"github.com/df-mc/dragonfly/server/event"
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+type Team struct{ Name string }
+
+type CombatTag struct{}
+
+type TagVictimHandler struct {
+	Manager *peex.Manager
+	Team    peex.Query[*Team]
+}
+
+func (h TagVictimHandler) HandleAttackEntity(ctx *event.Context, e world.Entity, force, height *float64, critical *bool) {
+	if victim, ok := h.Manager.SessionFromUUID(e.(*player.Player).UUID()); ok {
+		_ = victim.InsertComponent(&CombatTag{})
+	}
+}
+
+type FriendlyFireHandler struct {
+	Manager *peex.Manager
+	Team    peex.Query[*Team]
+	Victim  peex.Target[peex.Query[*Team]]
+}
+
+func (h FriendlyFireHandler) HandleAttackEntity(ctx *event.Context, e world.Entity, force, height *float64, critical *bool) {
+	if h.Team.Load().Name == h.Victim.Load().Load().Name {
+		ctx.Cancel()
+	}
+	victim, _ := h.Manager.SessionFromUUID(e.(*player.Player).UUID())
+	// Reading the session of the target is allowed, even though it is locked.
+	if _, ok := victim.Component(&Team{}); !ok {
+		panic("victim has no team")
+	}
+}
+
+func TestHandlerWithoutTargetModifiesTargetSession(t *testing.T) {
+	m := peex.New(peex.Config{Handlers: []peex.Handler{TagVictimHandler{}}})
+	attacker, victim := accept(t, m, &Team{}), accept(t, m, &Team{})
+
+	withTimeout(t, func() {
+		attacker.HandleAttackEntity(event.C(), victim.Player(), new(float64), new(float64), new(bool))
+	})
+	if _, ok := victim.Component(&CombatTag{}); !ok {
+		t.Fatal("victim was not tagged")
+	}
+}
+
+func TestTargetHandler(t *testing.T) {
+	m := peex.New(peex.Config{Handlers: []peex.Handler{FriendlyFireHandler{}}})
+	attacker, victim := accept(t, m, &Team{Name: "red"}), accept(t, m, &Team{Name: "red"})
+
+	ctx := event.C()
+	withTimeout(t, func() {
+		attacker.HandleAttackEntity(ctx, victim.Player(), new(float64), new(float64), new(bool))
+	})
+	if !ctx.Cancelled() {
+		t.Fatal("friendly fire was not cancelled")
+	}
+}
@@ -0,0 +1,57 @@
+package peex
+
+import "context"
+
+// Tracer creates spans around operations done by the Manager, which can be used to find out what is causing lag spikes.
+// It can be set in the Config, and may be used as an adapter to a tracing library such as OpenTelemetry. The methods
+// may be called from multiple goroutines at once.
+//
+// The following spans are created:
+//   - peex.event: handling an event for a session, with the player.uuid and event attributes.
+//   - peex.handler: a single handler handling an event, with the player.uuid, event and handler attributes. This is a
+//     child of the peex.event span.
+//   - peex.provider.load and peex.provider.save: a provider loading or saving a component, with the player.uuid and
+//     component attributes.
+//   - peex.query_id: a query on a player by UUID, with the player.uuid attribute.
+//   - peex.query_all: a query on all sessions.
+type Tracer interface {
+	// Start starts a new span with the name and attributes. The span is a child of the span in the context, if there is
+	// one. The returned context should contain the new span, and is used as parent for spans started during the
+	// operation.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span represents a single operation that is being traced.
+type Span interface {
+	// End is called once the operation is finished. The error is the error that the operation resulted in, or nil if
+	// it was successful.
+	End(err error)
+}
+
+// Attribute is a key-value pair that describes a span.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// NopTracer is a Tracer that does nothing. It is used if no tracer is set in the Config.
+type NopTracer struct{}
+
+// Start ...
+func (NopTracer) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+/// Internal tracing logic
+/// ----------------------
+
+type nopSpan struct{}
+
+func (nopSpan) End(error) {}
+
+// tracing returns whether a tracer other than the NopTracer is used. This is checked before starting spans in hot paths
+// to prevent attributes from being created when they are not used.
+func (m *Manager) tracing() bool {
+	_, nop := m.tracer.(NopTracer)
+	return !nop
+}
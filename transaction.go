@@ -0,0 +1,91 @@
+package peex
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Tx is used in query functions to make structural changes to sessions, such as adding and removing components. These
+// changes cannot be made directly, as the sessions are locked while the query function runs. Instead, all changes made
+// through a Tx are applied in order after every lock held by the query has been released. A *Tx can be added as a
+// parameter to any query function, except for those passed to Manager.QueryID.
+type Tx struct {
+	ops []func() error
+}
+
+// InsertComponent inserts a component into the session once the transaction is applied. See Session.InsertComponent.
+func (tx *Tx) InsertComponent(s *Session, c Component) {
+	tx.ops = append(tx.ops, func() error {
+		return s.InsertComponent(c)
+	})
+}
+
+// SetComponent sets a component in the session once the transaction is applied. See Session.SetComponent.
+func (tx *Tx) SetComponent(s *Session, c Component) {
+	tx.ops = append(tx.ops, func() error {
+		s.SetComponent(c)
+		return nil
+	})
+}
+
+// RemoveComponent removes the component with the same type as the argument from the session once the transaction is
+// applied. See Session.RemoveComponent.
+func (tx *Tx) RemoveComponent(s *Session, c Component) {
+	tx.ops = append(tx.ops, func() error {
+		_, err := s.RemoveComponent(c)
+		return err
+	})
+}
+
+/// Internal transaction logic
+/// --------------------------
+
+// apply executes all the operations stored in the transaction. Operations will still be executed if a previous one
+// failed, but only the last error is returned.
+func (tx *Tx) apply() error {
+	var e error
+	for _, op := range tx.ops {
+		if err := op(); err != nil {
+			e = err
+		}
+	}
+	tx.ops = nil
+
+	if e != nil {
+		return fmt.Errorf("error while applying transaction: %w", e)
+	}
+	return nil
+}
+
+// lockSessions acquires the component locks of all the sessions, which are read locks if read is true, to run a handler
+// or query function. The locks are always acquired in the order of the UUIDs of the session owners to prevent deadlocks
+// when multiple goroutines lock the same sessions. The returned function releases all the locks again.
+func lockSessions(sessions []*Session, read bool) (func(), error) {
+	sorted := make([]*Session, len(sessions))
+	copy(sorted, sessions)
+	sortSessions(sorted)
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i] == sorted[i-1] {
+			return nil, errors.New("cannot lock the same session multiple times")
+		}
+	}
+
+	for _, s := range sorted {
+		s.acquire(!read)
+	}
+	release := func() {
+		for i := len(sorted) - 1; i >= 0; i-- {
+			sorted[i].release(!read)
+		}
+	}
+	return release, nil
+}
+
+// sortSessions sorts the sessions by the UUIDs of their owners.
+func sortSessions(sessions []*Session) {
+	sort.Slice(sessions, func(i, j int) bool {
+		return bytes.Compare(sessions[i].id[:], sessions[j].id[:]) < 0
+	})
+}
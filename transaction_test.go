@@ -0,0 +1,144 @@
+package peex_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/andreashgk/peex"
+)
+
+func TestQueryManyTrade(t *testing.T) {
+	m := peex.New(peex.Config{})
+	a, b := accept(t, m, &Counter{N: 5}), accept(t, m, &Counter{N: 1})
+
+	var ran bool
+	var err error
+	withTimeout(t, func() {
+		ran, err = m.QueryMany([]*peex.Session{a, b}, func(from peex.Mut[*Counter], to peex.Mut[*Counter]) {
+			from.Load().N -= 2
+			to.Load().N += 2
+		})
+	})
+	if !ran || err != nil {
+		t.Fatalf("QueryMany returned %v, %v, expected it to run without errors", ran, err)
+	}
+	ca, _ := a.Component(&Counter{})
+	cb, _ := b.Component(&Counter{})
+	if ca.(*Counter).N != 3 || cb.(*Counter).N != 3 {
+		t.Fatalf("counters are %v and %v, expected 3 and 3", ca.(*Counter).N, cb.(*Counter).N)
+	}
+}
+
+func TestQueryManyLockOrder(t *testing.T) {
+	m := peex.New(peex.Config{})
+	a, b := accept(t, m, &Counter{}), accept(t, m, &Counter{})
+
+	// Sessions passed in opposite orders are still locked in the same order, so this must not deadlock.
+	withTimeout(t, func() {
+		var wg sync.WaitGroup
+		for _, sessions := range [][]*peex.Session{{a, b}, {b, a}} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					_, _ = m.QueryMany(sessions, func(x peex.Mut[*Counter], y peex.Mut[*Counter]) {
+						x.Load().N++
+						y.Load().N++
+					})
+				}
+			}()
+		}
+		wg.Wait()
+	})
+	ca, _ := a.Component(&Counter{})
+	if ca.(*Counter).N != 400 {
+		t.Fatalf("counter is %v, expected 400", ca.(*Counter).N)
+	}
+}
+
+func TestQueryManyTxAppliedAfterUnlock(t *testing.T) {
+	m := peex.New(peex.Config{})
+	a, b := accept(t, m, &Counter{}), accept(t, m, &Counter{}, &Marker{})
+
+	var markedDuring bool
+	var err error
+	withTimeout(t, func() {
+		_, err = m.QueryMany([]*peex.Session{a, b}, func(tx *peex.Tx, x peex.Mut[*Counter], y peex.Query[*Counter]) {
+			// The sessions are locked while the function runs, so applying the changes now would deadlock.
+			tx.InsertComponent(a, &Marker{})
+			tx.RemoveComponent(b, &Marker{})
+			tx.SetComponent(b, &Team{Name: "red"})
+			_, markedDuring = a.Component(&Marker{})
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if markedDuring {
+		t.Fatal("transaction was applied before the query function returned")
+	}
+	if !hasComponent(a, &Marker{}) || hasComponent(b, &Marker{}) || !hasComponent(b, &Team{}) {
+		t.Fatal("transaction was not applied after the query function returned")
+	}
+}
+
+func TestQueryManyErrors(t *testing.T) {
+	m := peex.New(peex.Config{})
+	a, b := accept(t, m, &Counter{}, &Marker{}), accept(t, m)
+
+	t.Run("same session", func(t *testing.T) {
+		ran, err := m.QueryMany([]*peex.Session{a, a}, func(peex.Query[*Counter], peex.Query[*Counter]) {})
+		if ran || err == nil {
+			t.Fatalf("QueryMany returned %v, %v, expected an error", ran, err)
+		}
+	})
+	t.Run("missing component", func(t *testing.T) {
+		ran, err := m.QueryMany([]*peex.Session{a, b}, func(peex.Query[*Counter], peex.Query[*Counter]) {
+			t.Error("query ran without all components")
+		})
+		if ran || err != nil {
+			t.Fatalf("QueryMany returned %v, %v, expected it not to run", ran, err)
+		}
+	})
+	t.Run("failing operation", func(t *testing.T) {
+		ran, err := m.QueryMany([]*peex.Session{a, b}, func(tx *peex.Tx, c peex.Query[*Counter], _ peex.Option[*Counter]) {
+			// Inserting a component that is already present fails, but the other operations are still applied.
+			tx.InsertComponent(a, &Marker{})
+			tx.InsertComponent(b, &Marker{})
+		})
+		if !ran || err == nil {
+			t.Fatalf("QueryMany returned %v, %v, expected it to run and return an error", ran, err)
+		}
+		if !hasComponent(b, &Marker{}) {
+			t.Fatal("operation after the failing one was not applied")
+		}
+	})
+	t.Run("parameter count", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("QueryMany with parameters that cannot be split did not panic")
+			}
+		}()
+		_, _ = m.QueryMany([]*peex.Session{a, b}, func(peex.Query[*Counter]) {})
+	})
+	// The sessions must not have been left locked by any of the errors.
+	withTimeout(t, func() {
+		a.SetComponent(&Counter{})
+		b.SetComponent(&Counter{})
+	})
+}
+
+func TestQueryTx(t *testing.T) {
+	m := peex.New(peex.Config{})
+	s := accept(t, m, &Counter{})
+
+	withTimeout(t, func() {
+		s.Query(func(tx *peex.Tx, c peex.Mut[*Counter]) {
+			tx.RemoveComponent(s, &Counter{})
+			tx.InsertComponent(s, &Marker{})
+		})
+	})
+	if hasComponent(s, &Counter{}) || !hasComponent(s, &Marker{}) {
+		t.Fatal("transaction was not applied after the query")
+	}
+}
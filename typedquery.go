@@ -0,0 +1,240 @@
+package peex
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"reflect"
+)
+
+// Query1 is a precompiled query for a single component type. Unlike query functions, it does not use any reflection
+// when it is run, which makes it a better fit for queries that run very often. A Query1 can be created once using
+// NewQuery1 and then be reused for as long as the Manager exists.
+// By default, the session is locked for reading while the function runs, so the components must only be read. A query
+// that modifies the components must be created using Mut, which locks the session for writing instead. Components are
+// passed to the function by value, so only components that are pointers can be modified. A query created using Mut must
+// not be run for a session that is locked by the handler or query function it is run from, as it would wait for the
+// lock forever.
+type Query1[A Component] struct {
+	m       *Manager
+	a       componentId
+	mutable bool
+}
+
+// NewQuery1 creates a new precompiled query for the component type A.
+func NewQuery1[A Component](m *Manager) Query1[A] {
+	return Query1[A]{m: m, a: componentIdOf[A](m)}
+}
+
+// Mut returns a copy of the query that locks the session for writing while the function runs, so that the components
+// may be modified in the function.
+func (q Query1[A]) Mut() Query1[A] {
+	q.mutable = true
+	return q
+}
+
+// Run runs the function on the session if it has the component. Returns whether the function ran.
+func (q Query1[A]) Run(s *Session, f func(A)) bool {
+	s.acquire(q.mutable)
+	defer s.release(q.mutable)
+
+	_, a, ok := s.queryComponent(q.a)
+	if !ok {
+		return false
+	}
+	f(a.(A))
+	return true
+}
+
+// Each runs the function on every session that has the component, and returns the amount of sessions it ran for.
+func (q Query1[A]) Each(f func(A)) int {
+	return q.m.each([]componentId{q.a}, func(s *Session) bool {
+		return q.Run(s, f)
+	})
+}
+
+// ByID runs the function on the player with the UUID, regardless of whether they are online or not. Components are
+// loaded using their provider if they are not present, in the same way as Manager.QueryID. Returns whether the function
+// ran, along with any error returned by a provider.
+func (q Query1[A]) ByID(id uuid.UUID, f func(A)) (bool, error) {
+	return q.m.queryComponentsByID(id, q.mutable, []componentId{q.a}, func(c []Component) {
+		f(c[0].(A))
+	})
+}
+
+// Query2 is a precompiled query for two component types. It works the same way as Query1.
+type Query2[A, B Component] struct {
+	m       *Manager
+	a, b    componentId
+	mutable bool
+}
+
+// NewQuery2 creates a new precompiled query for the component types A and B.
+func NewQuery2[A, B Component](m *Manager) Query2[A, B] {
+	return Query2[A, B]{m: m, a: componentIdOf[A](m), b: componentIdOf[B](m)}
+}
+
+// Mut returns a copy of the query that locks the session for writing while the function runs. See Query1.Mut.
+func (q Query2[A, B]) Mut() Query2[A, B] {
+	q.mutable = true
+	return q
+}
+
+// Run runs the function on the session if it has both components. Returns whether the function ran.
+func (q Query2[A, B]) Run(s *Session, f func(A, B)) bool {
+	s.acquire(q.mutable)
+	defer s.release(q.mutable)
+
+	_, a, ok := s.queryComponent(q.a)
+	if !ok {
+		return false
+	}
+	_, b, ok := s.queryComponent(q.b)
+	if !ok {
+		return false
+	}
+	f(a.(A), b.(B))
+	return true
+}
+
+// Each runs the function on every session that has both components, and returns the amount of sessions it ran for.
+func (q Query2[A, B]) Each(f func(A, B)) int {
+	return q.m.each([]componentId{q.a, q.b}, func(s *Session) bool {
+		return q.Run(s, f)
+	})
+}
+
+// ByID runs the function on the player with the UUID, regardless of whether they are online or not. See Query1.ByID.
+func (q Query2[A, B]) ByID(id uuid.UUID, f func(A, B)) (bool, error) {
+	return q.m.queryComponentsByID(id, q.mutable, []componentId{q.a, q.b}, func(c []Component) {
+		f(c[0].(A), c[1].(B))
+	})
+}
+
+// Query3 is a precompiled query for three component types. It works the same way as Query1.
+type Query3[A, B, C Component] struct {
+	m       *Manager
+	a, b, c componentId
+	mutable bool
+}
+
+// NewQuery3 creates a new precompiled query for the component types A, B and C.
+func NewQuery3[A, B, C Component](m *Manager) Query3[A, B, C] {
+	return Query3[A, B, C]{m: m, a: componentIdOf[A](m), b: componentIdOf[B](m), c: componentIdOf[C](m)}
+}
+
+// Mut returns a copy of the query that locks the session for writing while the function runs. See Query1.Mut.
+func (q Query3[A, B, C]) Mut() Query3[A, B, C] {
+	q.mutable = true
+	return q
+}
+
+// Run runs the function on the session if it has all three components. Returns whether the function ran.
+func (q Query3[A, B, C]) Run(s *Session, f func(A, B, C)) bool {
+	s.acquire(q.mutable)
+	defer s.release(q.mutable)
+
+	_, a, ok := s.queryComponent(q.a)
+	if !ok {
+		return false
+	}
+	_, b, ok := s.queryComponent(q.b)
+	if !ok {
+		return false
+	}
+	_, c, ok := s.queryComponent(q.c)
+	if !ok {
+		return false
+	}
+	f(a.(A), b.(B), c.(C))
+	return true
+}
+
+// Each runs the function on every session that has all three components, and returns the amount of sessions it ran
+// for.
+func (q Query3[A, B, C]) Each(f func(A, B, C)) int {
+	return q.m.each([]componentId{q.a, q.b, q.c}, func(s *Session) bool {
+		return q.Run(s, f)
+	})
+}
+
+// ByID runs the function on the player with the UUID, regardless of whether they are online or not. See Query1.ByID.
+func (q Query3[A, B, C]) ByID(id uuid.UUID, f func(A, B, C)) (bool, error) {
+	return q.m.queryComponentsByID(id, q.mutable, []componentId{q.a, q.b, q.c}, func(c []Component) {
+		f(c[0].(A), c[1].(B), c[2].(C))
+	})
+}
+
+/// Internal typed query logic
+/// --------------------------
+
+// componentIdOf returns the ID of the component type T, creating one if it does not exist yet.
+func componentIdOf[T Component](m *Manager) componentId {
+	return m.getComponentIdRefl(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// each runs the function for every session that has all the components with the IDs according to the index, returning
+// the amount of sessions for which it returned true.
+func (m *Manager) each(cIds []componentId, f func(s *Session) bool) int {
+	_, span := m.tracer.Start(context.Background(), "peex.query_all")
+	defer span.End(nil)
+
+	count := 0
+	m.sessionMu.RLock()
+	for _, s := range m.indexedSessions(cIds) {
+		if f(s) {
+			count++
+		}
+	}
+	m.sessionMu.RUnlock()
+	return count
+}
+
+// queryComponentsByID fetches the components with the IDs from the player with the UUID, and passes them to the
+// function in the same order. Components that are not present are loaded using their provider, and saved again after
+// the function ran. The function does not run if a component could not be fetched. The session of the player, if it is
+// online, is locked for writing if mutable is true, and for reading otherwise.
+func (m *Manager) queryComponentsByID(id uuid.UUID, mutable bool, cIds []componentId, f func(c []Component)) (ran bool, err error) {
+	_, span := m.tracer.Start(context.Background(), "peex.query_id", Attribute{Key: "player.uuid", Value: id.String()})
+	defer func() {
+		span.End(err)
+	}()
+
+	m.sessionMu.RLock()
+	defer m.sessionMu.RUnlock()
+	s, hasSession := m.sessions[id]
+	if hasSession {
+		s.acquire(mutable)
+		defer s.release(mutable)
+	}
+
+	comps := make([]Component, len(cIds))
+	var loaded []int
+	for i, cId := range cIds {
+		if hasSession {
+			if _, c, ok := s.queryComponent(cId); ok {
+				comps[i] = c
+				continue
+			}
+		}
+		p, ok := m.componentProvs[cId]
+		if !ok {
+			return false, nil
+		}
+		c, err := m.loadNewComponent(p, cId, id)
+		if err != nil {
+			return false, fmt.Errorf("error loading component: %w", err)
+		}
+		comps[i] = c
+		loaded = append(loaded, i)
+	}
+
+	f(comps)
+	// Save all the components that were loaded because of this query.
+	for _, i := range loaded {
+		if err := m.saveComponent(m.componentProvs[cIds[i]], cIds[i], id, comps[i]); err != nil {
+			return true, fmt.Errorf("error saving component: %w", err)
+		}
+	}
+	return true, nil
+}
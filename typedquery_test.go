@@ -0,0 +1,53 @@
+package peex_test
+
+import (
+	"testing"
+
+	"github.com/andreashgk/peex"
+)
+
+func TestTypedQueryReadsFromQuery(t *testing.T) {
+	m := peex.New(peex.Config{})
+	s := accept(t, m, &Counter{N: 1}, &Team{Name: "red"})
+	q := peex.NewQuery2[*Counter, *Team](m)
+
+	var ran bool
+	withTimeout(t, func() {
+		s.Query(func(c peex.Query[*Counter]) {
+			// A typed query only takes the read lock, so it can run while the session is already read locked.
+			ran = q.Run(s, func(c *Counter, team *Team) {})
+		})
+	})
+	if !ran {
+		t.Fatal("typed query did not run")
+	}
+}
+
+func TestTypedQueryMut(t *testing.T) {
+	m := peex.New(peex.Config{})
+	s := accept(t, m, &Counter{}, &Team{}, &Marker{})
+	accept(t, m, &Counter{}, &Team{})
+	q := peex.NewQuery3[*Counter, *Team, *Marker](m).Mut()
+
+	withTimeout(t, func() {
+		if !q.Run(s, func(c *Counter, team *Team, _ *Marker) { c.N++ }) {
+			t.Error("query did not run")
+		}
+		if n := peex.NewQuery2[*Counter, *Team](m).Mut().Each(func(c *Counter, _ *Team) { c.N++ }); n != 2 {
+			t.Errorf("query ran for %v sessions, expected 2", n)
+		}
+	})
+	c, _ := s.Component(&Counter{})
+	if c.(*Counter).N != 2 {
+		t.Fatalf("counter is %v, expected 2", c.(*Counter).N)
+	}
+}
+
+func TestTypedQueryMissingComponent(t *testing.T) {
+	m := peex.New(peex.Config{})
+	s := accept(t, m, &Counter{})
+
+	if peex.NewQuery2[*Counter, *Team](m).Run(s, func(*Counter, *Team) { t.Error("query ran without a team") }) {
+		t.Fatal("query reported that it ran")
+	}
+}
@@ -0,0 +1,173 @@
+package peex
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HandlerStats contains statistics about how long a handler takes to handle events. These are only collected when the
+// slow handler watchdog is enabled by setting SlowHandlerThreshold in the Config. Statistics that are not totals only
+// cover the last minute.
+type HandlerStats struct {
+	// Handler is the handler as it was registered in the Config.
+	Handler Handler
+	// Calls is the amount of times the handler handled an event.
+	Calls int
+	// Slow is the amount of times the handler took longer than the threshold to handle an event.
+	Slow int
+	// Max is the longest time the handler took to handle an event.
+	Max time.Duration
+	// TotalCalls and TotalSlow are the same as Calls and Slow, but since the manager was created.
+	TotalCalls, TotalSlow uint64
+}
+
+// HandlerStats returns the statistics collected by the slow handler watchdog for every handler, in the order the
+// handlers were registered. All statistics will be zero if the watchdog is not enabled.
+func (m *Manager) HandlerStats() []HandlerStats {
+	handlers := m.handlers.Load()
+	stats := make([]HandlerStats, 0, len(handlers.handlers))
+	for id := handlerId(0); id < handlers.nextId; id++ {
+		info, ok := handlers.handlers[id]
+		if !ok {
+			continue
+		}
+		st := info.state.stats.collect(time.Now().Unix())
+		st.Handler = info.h
+		stats = append(stats, st)
+	}
+	return stats
+}
+
+/// Internal watchdog logic
+/// -----------------------
+
+// statsWindow is the amount of seconds covered by the rolling handler statistics.
+const statsWindow = 60
+
+// handlerStats keeps track of rolling statistics about the invocations of a handler, using a bucket for every second.
+type handlerStats struct {
+	mu      sync.Mutex
+	buckets [statsWindow]statsBucket
+
+	totalCalls, totalSlow uint64
+	// lastStack is the second at which the stack of the handler was last logged.
+	lastStack int64
+}
+
+type statsBucket struct {
+	second      int64
+	calls, slow int
+	max         time.Duration
+}
+
+// record adds a single invocation of the handler to the statistics.
+func (st *handlerStats) record(now int64, d time.Duration, slow bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	b := &st.buckets[now%statsWindow]
+	if b.second != now {
+		*b = statsBucket{second: now}
+	}
+	b.calls++
+	st.totalCalls++
+	if slow {
+		b.slow++
+		st.totalSlow++
+	}
+	if d > b.max {
+		b.max = d
+	}
+}
+
+// allowStack returns whether the stack of a slow invocation of the handler may be logged. Capturing the stack of
+// another goroutine requires the stacks of all goroutines, which stops the world, so this is only allowed once per
+// window for every handler.
+func (st *handlerStats) allowStack(now int64) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.lastStack != 0 && now-st.lastStack < statsWindow {
+		return false
+	}
+	st.lastStack = now
+	return true
+}
+
+// collect sums up the buckets that are still within the window.
+func (st *handlerStats) collect(now int64) HandlerStats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	stats := HandlerStats{TotalCalls: st.totalCalls, TotalSlow: st.totalSlow}
+	for _, b := range st.buckets {
+		if now-b.second >= statsWindow {
+			continue
+		}
+		stats.Calls += b.calls
+		stats.Slow += b.slow
+		if b.max > stats.Max {
+			stats.Max = b.max
+		}
+	}
+	return stats
+}
+
+// watchHandler starts watching a handler that is about to run on the current goroutine. If the handler is still running
+// once the threshold has passed, a warning is logged. The stack of the goroutine is included at most once per minute for
+// every handler. The returned function must be called with the time the handler took once it has returned.
+func (s *Session) watchHandler(eventId eventId, info handlerInfo) func(d time.Duration) {
+	threshold := s.m.slowThreshold
+	gid := goroutineId()
+	timer := time.AfterFunc(threshold, func() {
+		if !info.state.stats.allowStack(time.Now().Unix()) {
+			s.log.Warn("handler is taking too long", "handler", info.name, "event", eventName(eventId),
+				"threshold", threshold)
+			return
+		}
+		s.log.Warn("handler is taking too long", "handler", info.name, "event", eventName(eventId),
+			"threshold", threshold, "stack", goroutineStack(gid))
+	})
+	return func(d time.Duration) {
+		timer.Stop()
+		info.state.stats.record(time.Now().Unix(), d, d > threshold)
+	}
+}
+
+// goroutineId returns the ID of the current goroutine, as it is shown in stack traces.
+func goroutineId() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// The stack starts with "goroutine <id> [<status>]:".
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i != -1 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
+
+// goroutineStack returns the stack of the goroutine with the ID, or an empty string if it could not be found. It stops
+// the world while the stacks of all goroutines are collected, so it should be used sparingly.
+func goroutineStack(id uint64) string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+
+	prefix := []byte("goroutine " + strconv.FormatUint(id, 10) + " ")
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(stack, prefix) {
+			return string(stack)
+		}
+	}
+	return ""
+}
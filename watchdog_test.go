@@ -0,0 +1,69 @@
+package peex_test
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andreashgk/peex"
+)
+
+type SlowHandler struct {
+	Counter peex.Query[*Counter]
+}
+
+func (SlowHandler) HandleJump() {
+	time.Sleep(50 * time.Millisecond)
+}
+
+// recordHandler is a slog.Handler that stores whether every record with the message has a stack attribute.
+type recordHandler struct {
+	msg    string
+	mu     sync.Mutex
+	stacks []bool
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	if r.Message != h.msg {
+		return nil
+	}
+	stack := false
+	r.Attrs(func(a slog.Attr) bool {
+		stack = stack || a.Key == "stack" && a.Value.String() != ""
+		return true
+	})
+	h.mu.Lock()
+	h.stacks = append(h.stacks, stack)
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *recordHandler) WithGroup(string) slog.Handler { return h }
+
+func TestSlowHandlerStackIsRateLimited(t *testing.T) {
+	rec := &recordHandler{msg: "handler is taking too long"}
+	m := peex.New(peex.Config{
+		Log:                  slog.New(rec),
+		SlowHandlerThreshold: 10 * time.Millisecond,
+		Handlers:             []peex.Handler{SlowHandler{}},
+	})
+	s := accept(t, m, &Counter{})
+
+	for i := 0; i < 3; i++ {
+		s.HandleJump()
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.stacks) != 3 {
+		t.Fatalf("logged %v slow handler warnings, expected 3", len(rec.stacks))
+	}
+	if !rec.stacks[0] || rec.stacks[1] || rec.stacks[2] {
+		t.Fatalf("expected only the first warning to have a stack, got %v", rec.stacks)
+	}
+}